@@ -0,0 +1,92 @@
+// Copyright 2022, NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gomaddness
+
+// Aggregation identifies the strategy used to aggregate the lookup-table
+// entries selected for a data vector into a single value, during the product
+// quantization's aggregation step.
+type Aggregation uint8
+
+const (
+	// AggregationExact sums all the selected lookup-table entries exactly.
+	AggregationExact Aggregation = iota
+	// AggregationAveraging approximates the sum of the selected lookup-table
+	// entries, averaging pairs of 8-bit values in a binary tree, rounding
+	// upwards, just like the vpavgb SIMD instruction does. The result is
+	// then corrected for the expected bias introduced by the rounding.
+	AggregationAveraging
+)
+
+// maxAveragingGroupSize is the maximum amount of lookup-table entries
+// aggregated by a single averaging tree. Larger groups are split, and
+// their estimated sums are added together exactly.
+const maxAveragingGroupSize = 16
+
+// String returns a human-readable name of the aggregation strategy.
+func (a Aggregation) String() string {
+	switch a {
+	case AggregationExact:
+		return "exact"
+	case AggregationAveraging:
+		return "averaging"
+	default:
+		return "unknown"
+	}
+}
+
+// exactSum returns the exact sum of the lookup-table entries at the given
+// indices.
+func exactSum(data []uint8, indices []uint16) uint32 {
+	var sum uint32
+	for _, i := range indices {
+		sum += uint32(data[i])
+	}
+	return sum
+}
+
+// averagingSum estimates the sum of the lookup-table entries at the given
+// indices, using AggregationAveraging.
+//
+// The indices are split into groups whose size is a power of two (at most
+// maxAveragingGroupSize). The values of each group are averaged in a
+// binary tree, and the group's sum is estimated from the average.
+func averagingSum[F Float](data []uint8, indices []uint16) F {
+	var sum F
+	for len(indices) > 0 {
+		n := maxAveragingGroupSize
+		for n > len(indices) {
+			n /= 2
+		}
+		sum += averagingGroupSum[F](data, indices[:n])
+		indices = indices[n:]
+	}
+	return sum
+}
+
+// averagingGroupSum estimates the sum of the lookup-table entries at the
+// given indices, whose amount n MUST be a power of two, not greater than
+// maxAveragingGroupSize.
+//
+// Each rounded-up pairwise average (a+b+1)>>1 overestimates the exact
+// average (a+b)/2 by 1/2 when a+b is odd, that is, by 1/4 on average.
+// Since averaging preserves the expected error of its inputs, each of the
+// log2(n) levels of the tree adds 1/4 to the expected bias of the final
+// average, so that the expected bias of the estimated sum (the average
+// multiplied by n) is n*log2(n)/4, which is subtracted.
+func averagingGroupSum[F Float](data []uint8, indices []uint16) F {
+	var buf [maxAveragingGroupSize]uint8
+	n := len(indices)
+	for i, index := range indices {
+		buf[i] = data[index]
+	}
+	levels := 0
+	for size := n; size > 1; size /= 2 {
+		for i := 0; i < size/2; i++ {
+			buf[i] = uint8((uint16(buf[2*i]) + uint16(buf[2*i+1]) + 1) >> 1)
+		}
+		levels++
+	}
+	return F(buf[0])*F(n) - F(n*levels)/4
+}
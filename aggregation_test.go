@@ -0,0 +1,133 @@
+// Copyright 2022, NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gomaddness
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestAveragingSum(t *testing.T) {
+	t.Run("float32", testAveragingSum[float32])
+	t.Run("float64", testAveragingSum[float64])
+}
+
+func testAveragingSum[F Float](t *testing.T) {
+	t.Run("only bias correction when all values are equal", func(t *testing.T) {
+		data := []uint8{42, 42, 42, 42, 42, 42, 42, 42}
+		for n := 1; n <= len(data); n++ {
+			indices := make([]uint16, n)
+			for i := range indices {
+				indices[i] = uint16(i)
+			}
+			actual := averagingSum[F](data, indices)
+			// With equal values no rounding occurs, so each group of g
+			// values (a power of two) sums to exactly 42g - g*log2(g)/4.
+			var expected float64
+			for rest := n; rest > 0; {
+				g := maxAveragingGroupSize
+				for g > rest {
+					g /= 2
+				}
+				expected += 42*float64(g) - float64(g)*math.Log2(float64(g))/4
+				rest -= g
+			}
+			if float64(actual) != expected {
+				t.Errorf("n=%d: expected %v, actual %v", n, expected, actual)
+			}
+		}
+	})
+
+	for _, numSubspaces := range []int{1, 2, 4, 8, 16, 32, 48, 100} {
+		meanErr, meanAbsErr, maxAbsErr := averagingSumErrors[F](numSubspaces, 2000)
+		t.Logf("subspaces=%d\tmean error %.4f\tmean abs error %.4f\tmax abs error %.4f",
+			numSubspaces, meanErr, meanAbsErr, maxAbsErr)
+
+		// The correction must make the estimator (almost) unbiased.
+		if math.Abs(meanErr) > 0.05*float64(numSubspaces)+0.5 {
+			t.Errorf("subspaces=%d: mean error %v is too large", numSubspaces, meanErr)
+		}
+		// Each group of n values can be off by n*log2(n)/4 at most,
+		// and groups have at most 16 values.
+		if maxAbsErr > float64(numSubspaces) {
+			t.Errorf("subspaces=%d: max abs error %v is too large", numSubspaces, maxAbsErr)
+		}
+	}
+}
+
+func averagingSumErrors[F Float](numSubspaces, trials int) (meanErr, meanAbsErr, maxAbsErr float64) {
+	r := rand.New(rand.NewSource(1))
+
+	data := make([]uint8, numSubspaces*16)
+	indices := make([]uint16, numSubspaces)
+
+	for trial := 0; trial < trials; trial++ {
+		for i := range data {
+			data[i] = uint8(r.Intn(256))
+		}
+		for i := range indices {
+			indices[i] = uint16(i*16 + r.Intn(16))
+		}
+
+		exact := float64(exactSum(data, indices))
+		approx := float64(averagingSum[F](data, indices))
+		e := approx - exact
+
+		meanErr += e
+		meanAbsErr += math.Abs(e)
+		if math.Abs(e) > maxAbsErr {
+			maxAbsErr = math.Abs(e)
+		}
+	}
+	meanErr /= float64(trials)
+	meanAbsErr /= float64(trials)
+	return
+}
+
+func TestMaddness_DotProduct_Aggregation(t *testing.T) {
+	t.Run("float32", testMaddnessDotProductAggregation[float32])
+	t.Run("float64", testMaddnessDotProductAggregation[float64])
+}
+
+func testMaddnessDotProductAggregation[F Float](t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	examples := make(Vectors[F], 256)
+	for i := range examples {
+		examples[i] = make(Vector[F], 32)
+		for j := range examples[i] {
+			examples[i][j] = F(r.NormFloat64())
+		}
+	}
+	queryVectors := examples[:4]
+
+	m := TrainMaddness(examples, queryVectors, 16)
+
+	var sumExact, sumAveraging, count float64
+	for _, ex := range examples {
+		lutIndices := m.LookupTableIndices(m.Quantize(ex))
+		for qi, qv := range queryVectors {
+			expected := float64(ex.DotProduct(qv))
+
+			m.Aggregation = AggregationExact
+			exact := float64(m.DotProduct(lutIndices, qi))
+
+			m.Aggregation = AggregationAveraging
+			averaging := float64(m.DotProduct(lutIndices, qi))
+
+			sumExact += math.Abs(exact - expected)
+			sumAveraging += math.Abs(averaging - expected)
+			count++
+		}
+	}
+
+	maeExact := sumExact / count
+	maeAveraging := sumAveraging / count
+	t.Logf("mean absolute error: exact %.4f, averaging %.4f", maeExact, maeAveraging)
+
+	if maeAveraging > maeExact*1.5 {
+		t.Errorf("averaging error %v is too large compared to exact error %v", maeAveraging, maeExact)
+	}
+}
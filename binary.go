@@ -0,0 +1,183 @@
+// Copyright 2022, NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gomaddness
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"unsafe"
+
+	"github.com/nlpodyssey/gomaddness/internal/endian"
+)
+
+// errUnexpectedEOF is reported when decoding truncated data.
+var errUnexpectedEOF = errors.New("maddness: unexpected end of data")
+
+// binaryWriter writes little-endian values, keeping track of the amount of
+// bytes written, and of the first error encountered.
+type binaryWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+	buf [8]byte
+}
+
+func (bw *binaryWriter) bytes(b []byte) {
+	if bw.err != nil {
+		return
+	}
+	n, err := bw.w.Write(b)
+	bw.n += int64(n)
+	bw.err = err
+}
+
+func (bw *binaryWriter) uint8(v uint8) {
+	bw.buf[0] = v
+	bw.bytes(bw.buf[:1])
+}
+
+func (bw *binaryWriter) uint32(v uint32) {
+	binary.LittleEndian.PutUint32(bw.buf[:4], v)
+	bw.bytes(bw.buf[:4])
+}
+
+func (bw *binaryWriter) uint64(v uint64) {
+	binary.LittleEndian.PutUint64(bw.buf[:8], v)
+	bw.bytes(bw.buf[:8])
+}
+
+// align writes zero bytes until the amount of bytes written is a multiple
+// of n.
+func (bw *binaryWriter) align(n int) {
+	var zeros [maxAlignment]byte
+	if pad := int(bw.n % int64(n)); pad != 0 {
+		bw.bytes(zeros[:n-pad])
+	}
+}
+
+// writeFloats writes the given values, using the size of F.
+func writeFloats[F Float](bw *binaryWriter, vs []F) {
+	for _, v := range vs {
+		if floatSize[F]() == 4 {
+			bw.uint32(math.Float32bits(float32(v)))
+		} else {
+			bw.uint64(math.Float64bits(float64(v)))
+		}
+	}
+}
+
+// maxAlignment is the maximum alignment supported by binaryWriter.align.
+const maxAlignment = 64
+
+// binaryReader reads little-endian values from a slice of bytes, keeping
+// track of the first error encountered.
+//
+// Slices of bytes and floats are returned without copying the underlying
+// data, whenever possible.
+type binaryReader struct {
+	b   []byte
+	pos int
+	err error
+}
+
+// bytes returns the next n bytes, sharing memory with the reader's data.
+func (br *binaryReader) bytes(n int) []byte {
+	if br.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(br.b)-br.pos {
+		br.err = errUnexpectedEOF
+		return nil
+	}
+	b := br.b[br.pos : br.pos+n : br.pos+n]
+	br.pos += n
+	return b
+}
+
+func (br *binaryReader) uint8() uint8 {
+	if b := br.bytes(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (br *binaryReader) uint32() uint32 {
+	if b := br.bytes(4); b != nil {
+		return binary.LittleEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (br *binaryReader) uint64() uint64 {
+	if b := br.bytes(8); b != nil {
+		return binary.LittleEndian.Uint64(b)
+	}
+	return 0
+}
+
+// int reads a uint64 value, reporting an error if it does not fit into
+// a non-negative int32.
+func (br *binaryReader) int() int {
+	v := br.uint64()
+	if br.err == nil && v > math.MaxInt32 {
+		br.err = errors.New("maddness: invalid integer value")
+		return 0
+	}
+	return int(v)
+}
+
+// length reads the amount of items of some upcoming data, reporting an
+// error if it exceeds the amount of remaining bytes, given that each item
+// occupies at least one byte.
+func (br *binaryReader) length() int {
+	v := br.uint64()
+	if br.err == nil && v > uint64(len(br.b)-br.pos) {
+		br.err = errUnexpectedEOF
+		return 0
+	}
+	return int(v)
+}
+
+// align skips bytes until the reading position is a multiple of n.
+func (br *binaryReader) align(n int) {
+	if pad := br.pos % n; pad != 0 {
+		br.bytes(n - pad)
+	}
+}
+
+// readFloats reads n values, using the size of F.
+//
+// On little-endian hosts, if the data is suitably aligned, the returned
+// slice shares memory with the reader's data.
+func readFloats[F Float](br *binaryReader, n int) []F {
+	size := floatSize[F]()
+	if br.err == nil && (n < 0 || n > (len(br.b)-br.pos)/size) {
+		br.err = errUnexpectedEOF
+	}
+	b := br.bytes(n * size)
+	if b == nil || n == 0 {
+		return make([]F, 0)
+	}
+	if endian.IsLittle && uintptr(unsafe.Pointer(&b[0]))%uintptr(size) == 0 {
+		return unsafe.Slice((*F)(unsafe.Pointer(&b[0])), n)
+	}
+	vs := make([]F, n)
+	for i := range vs {
+		if size == 4 {
+			vs[i] = F(math.Float32frombits(binary.LittleEndian.Uint32(b[i*4:])))
+		} else {
+			vs[i] = F(math.Float64frombits(binary.LittleEndian.Uint64(b[i*8:])))
+		}
+	}
+	return vs
+}
+
+// floatSize returns the size in bytes of F.
+func floatSize[F Float]() int {
+	var f F
+	return int(unsafe.Sizeof(f))
+}
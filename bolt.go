@@ -0,0 +1,47 @@
+// Copyright 2022, NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gomaddness
+
+import (
+	"math/rand"
+)
+
+// BoltNumCodes is the number of centroids of each subspace of a
+// BoltEncoder, so that codes fit in 4 bits.
+const BoltNumCodes = 16
+
+// BoltEncoder is the Encoder of Bolt (Blalock and Guttag, 2017), the
+// predecessor of MADDNESS: each sub-vector is assigned to the nearest of
+// 16 centroids, learned with k-means.
+//
+// Compared to PQEncoder, the small number of codes allows using the same
+// compact lookup tables of the hashing trees. Bolt's 8-bit lookup tables
+// correspond to PrecisionUint8 with ScalingPerSubspace (see WithBolt).
+type BoltEncoder[F Float] struct {
+	Codebook Vectors[F] `json:"prototypes"`
+}
+
+// TrainBoltEncoder learns the BoltNumCodes centroids from the given
+// examples, returning a new BoltEncoder.
+//
+// The random number generator rng is used for the k-means initialization.
+func TrainBoltEncoder[F Float](examples Vectors[F], rng *rand.Rand) *BoltEncoder[F] {
+	return &BoltEncoder[F]{Codebook: TrainPQEncoder(examples, BoltNumCodes, rng).Codebook}
+}
+
+// Encode returns the index of the centroid nearest to v.
+func (e *BoltEncoder[F]) Encode(v Vector[F]) uint8 {
+	return uint8(nearestPrototype(e.Codebook, v))
+}
+
+// Prototypes returns the centroids.
+func (e *BoltEncoder[F]) Prototypes() Vectors[F] {
+	return e.Codebook
+}
+
+// NumCodes returns the number of centroids.
+func (e *BoltEncoder[F]) NumCodes() int {
+	return len(e.Codebook)
+}
@@ -0,0 +1,64 @@
+// Copyright 2022, NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gomaddness
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestTrainBoltEncoder(t *testing.T) {
+	t.Run("float32", testTrainBoltEncoder[float32])
+	t.Run("float64", testTrainBoltEncoder[float64])
+}
+
+func testTrainBoltEncoder[F Float](t *testing.T) {
+	examples, _ := randomExamples[F](128, 4, 1)
+
+	e := TrainBoltEncoder(examples, rand.New(rand.NewSource(1)))
+	if e.NumCodes() != BoltNumCodes {
+		t.Fatalf("expected %d codes, actual %d", BoltNumCodes, e.NumCodes())
+	}
+	for _, x := range examples {
+		if code, expected := e.Encode(x), nearestPrototype(e.Prototypes(), x); int(code) != expected {
+			t.Errorf("expected code %d, actual %d", expected, code)
+		}
+	}
+}
+
+func TestTrainMaddness_bolt(t *testing.T) {
+	t.Run("float32", testTrainMaddnessBolt[float32])
+	t.Run("float64", testTrainMaddnessBolt[float64])
+}
+
+func testTrainMaddnessBolt[F Float](t *testing.T) {
+	examples, queryVectors := randomExamples[F](256, 12, 2)
+
+	m := TrainMaddness(examples, queryVectors, 4, WithBolt())
+	if m.Encoding != EncodingBolt || m.Precision != PrecisionUint8 || m.Scaling != ScalingPerSubspace {
+		t.Fatalf("unexpected settings: encoding %s, precision %s, scaling %s", m.Encoding, m.Precision, m.Scaling)
+	}
+	if err := m.checkStructure(); err != nil {
+		t.Fatal(err)
+	}
+	for _, lut := range m.LookupTables {
+		if len(lut.Data) != m.NumSubspaces*BoltNumCodes {
+			t.Fatalf("unexpected lookup-table size %d", len(lut.Data))
+		}
+	}
+	for _, x := range examples[:16] {
+		q := m.Quantize(x)
+		r := m.Reconstruct(q)
+		lutIndices := m.LookupTableIndices(q)
+		for j, qv := range queryVectors {
+			expected := r.DotProduct(qv)
+			tolerance := float64(m.LookupTables[j].MaxError)*float64(m.NumSubspaces) + 1e-4
+			if actual := m.DotProduct(lutIndices, j); math.Abs(float64(actual-expected)) > tolerance {
+				t.Errorf("expected %v, actual %v", expected, actual)
+			}
+		}
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright 2022, NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/nlpodyssey/gomaddness"
+	"github.com/nlpodyssey/gomaddness/csvdata"
+	"github.com/nlpodyssey/gomaddness/npy"
+)
+
+// isNpy reports whether the given path refers to a NumPy .npy file.
+func isNpy(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".npy")
+}
+
+// addCSVFlags adds to fs the flags controlling how CSV datasets are read,
+// returning the resulting options.
+func addCSVFlags(fs *flag.FlagSet) *csvdata.Options {
+	o := new(csvdata.Options)
+	fs.BoolVar(&o.Header, "header", false, "skip the header line of CSV datasets")
+	fs.Func("missing", "policy for missing values of CSV datasets: error, zero, mean or skip (default error)", func(s string) error {
+		policy, ok := missingPolicies[s]
+		if !ok {
+			return fmt.Errorf("unknown policy %q", s)
+		}
+		o.Missing = policy
+		return nil
+	})
+	return o
+}
+
+var missingPolicies = map[string]csvdata.MissingPolicy{
+	"error": csvdata.MissingError,
+	"zero":  csvdata.MissingZero,
+	"mean":  csvdata.MissingMean,
+	"skip":  csvdata.MissingSkipRow,
+}
+
+// readVectors reads a dataset from a .npy, CSV or TSV file.
+func readVectors(path string, o *csvdata.Options) (gomaddness.Vectors[float32], error) {
+	var vs gomaddness.Vectors[float32]
+	var err error
+	if isNpy(path) {
+		vs, err = readNpy(path)
+	} else {
+		vs, err = csvdata.Load[float32](path, *o)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(vs) == 0 {
+		return nil, fmt.Errorf("%s: empty dataset", path)
+	}
+	return vs, nil
+}
+
+func readNpy(path string) (gomaddness.Vectors[float32], error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	vs, err := npy.ReadVectors[float32](bufio.NewReader(f))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return vs, nil
+}
+
+// writeOutput calls write with the file at the given path, or with stdout
+// if path is empty.
+func writeOutput(path string, stdout io.Writer, write func(w io.Writer) error) (err error) {
+	if path == "" {
+		return write(stdout)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if e := f.Close(); e != nil && err == nil {
+			err = e
+		}
+	}()
+	w := bufio.NewWriter(f)
+	if err = write(w); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// writeVectors writes vs to the given path, as a .npy or CSV file,
+// or to stdout, as CSV, if path is empty.
+func writeVectors(path string, stdout io.Writer, vs gomaddness.Vectors[float32]) error {
+	return writeOutput(path, stdout, func(w io.Writer) error {
+		if isNpy(path) {
+			return npy.WriteVectors(w, vs)
+		}
+		return writeCSV(w, len(vs), func(i int) []string {
+			record := make([]string, len(vs[i]))
+			for j, x := range vs[i] {
+				record[j] = strconv.FormatFloat(float64(x), 'g', -1, 32)
+			}
+			return record
+		})
+	})
+}
+
+// writeCodes writes the codes of a dataset to the given path, as a .npy
+// file of uint8 values or as a CSV file, or to stdout, as CSV, if path is
+// empty.
+func writeCodes(path string, stdout io.Writer, codes [][]uint8) error {
+	return writeOutput(path, stdout, func(w io.Writer) error {
+		if isNpy(path) {
+			cols := 0
+			if len(codes) > 0 {
+				cols = len(codes[0])
+			}
+			data := make([]uint8, 0, len(codes)*cols)
+			for _, c := range codes {
+				data = append(data, c...)
+			}
+			return npy.WriteArray(w, []int{len(codes), cols}, data)
+		}
+		return writeCSV(w, len(codes), func(i int) []string {
+			record := make([]string, len(codes[i]))
+			for j, c := range codes[i] {
+				record[j] = strconv.Itoa(int(c))
+			}
+			return record
+		})
+	})
+}
+
+func writeCSV(w io.Writer, n int, record func(i int) []string) error {
+	cw := csv.NewWriter(w)
+	for i := 0; i < n; i++ {
+		if err := cw.Write(record(i)); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,106 @@
+// Copyright 2022, NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"io"
+
+	"github.com/nlpodyssey/gomaddness"
+	"github.com/nlpodyssey/gomaddness/csvdata"
+)
+
+func runEncode(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("encode", "-model MODEL -data FILE [-o FILE]", stderr)
+	modelPath := fs.String("model", "", "model file")
+	dataPath := fs.String("data", "", "data examples (.npy or CSV)")
+	output := fs.String("o", "", "output codes (.npy or CSV); CSV to stdout if omitted")
+	csvOptions := addCSVFlags(fs)
+	assignment := addAssignmentFlag(fs)
+	if err := parseFlags(fs, args, "model", "data"); err != nil {
+		return err
+	}
+
+	m, data, err := loadModelAndData(*modelPath, *dataPath, csvOptions)
+	if err != nil {
+		return err
+	}
+	assignment.apply(m)
+	codes := make([][]uint8, len(data))
+	for i, x := range data {
+		codes[i] = m.Quantize(x)
+	}
+	return writeCodes(*output, stdout, codes)
+}
+
+func runMatMul(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("matmul", "-model MODEL -data FILE [-o FILE]", stderr)
+	modelPath := fs.String("model", "", "model file")
+	dataPath := fs.String("data", "", "data examples (.npy or CSV)")
+	output := fs.String("o", "", "output product (.npy or CSV); CSV to stdout if omitted")
+	csvOptions := addCSVFlags(fs)
+	assignment := addAssignmentFlag(fs)
+	if err := parseFlags(fs, args, "model", "data"); err != nil {
+		return err
+	}
+
+	m, data, err := loadModelAndData(*modelPath, *dataPath, csvOptions)
+	if err != nil {
+		return err
+	}
+	assignment.apply(m)
+	return writeVectors(*output, stdout, m.MatMulVectors(data).Vectors())
+}
+
+func loadModelAndData(modelPath, dataPath string, o *csvdata.Options) (*gomaddness.Maddness[float32], gomaddness.Vectors[float32], error) {
+	m, err := gomaddness.Load[float32](modelPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := readVectors(dataPath, o)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := m.ValidateVectors(data); err != nil {
+		return nil, nil, err
+	}
+	return m, data, nil
+}
+
+// assignmentFlag is the value of the -assignment flag, which overrides
+// the assignment strategy of a loaded model, if set.
+type assignmentFlag struct {
+	value gomaddness.Assignment
+	set   bool
+}
+
+// addAssignmentFlag adds the -assignment flag to fs.
+func addAssignmentFlag(fs *flag.FlagSet) *assignmentFlag {
+	a := &assignmentFlag{}
+	fs.Var(a, "assignment", "override the model's assignment of sub-vectors to prototypes: encoder or nearest-prototype")
+	return a
+}
+
+func (a *assignmentFlag) String() string {
+	if a == nil || !a.set {
+		return ""
+	}
+	return a.value.String()
+}
+
+func (a *assignmentFlag) Set(s string) error {
+	if err := a.value.UnmarshalText([]byte(s)); err != nil {
+		return err
+	}
+	a.set = true
+	return nil
+}
+
+// apply sets the assignment strategy of m, if the flag is set.
+func (a *assignmentFlag) apply(m *gomaddness.Maddness[float32]) {
+	if a.set {
+		m.Assignment = a.value
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2022, NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/nlpodyssey/gomaddness"
+)
+
+func runEval(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("eval", "-model MODEL -data FILE -queries FILE", stderr)
+	modelPath := fs.String("model", "", "model file")
+	dataPath := fs.String("data", "", "data examples (.npy or CSV)")
+	queriesPath := fs.String("queries", "", "query vectors used for training the model (.npy or CSV)")
+	csvOptions := addCSVFlags(fs)
+	assignment := addAssignmentFlag(fs)
+	if err := parseFlags(fs, args, "model", "data", "queries"); err != nil {
+		return err
+	}
+
+	m, err := gomaddness.Load[float32](*modelPath)
+	if err != nil {
+		return err
+	}
+	assignment.apply(m)
+	data, err := readVectors(*dataPath, csvOptions)
+	if err != nil {
+		return err
+	}
+	queries, err := readVectors(*queriesPath, csvOptions)
+	if err != nil {
+		return err
+	}
+	if err := m.ValidateVectors(data); err != nil {
+		return err
+	}
+	if err := m.ValidateVectors(queries); err != nil {
+		return err
+	}
+	if len(queries) != len(m.LookupTables) {
+		return fmt.Errorf("eval: %d query vectors, but the model has %d lookup tables",
+			len(queries), len(m.LookupTables))
+	}
+
+	metrics := make([]gomaddness.Metric, len(m.LookupTables))
+	for i, lut := range m.LookupTables {
+		metrics[i] = lut.Metric
+	}
+	e := evaluate(m.MatMulVectors(data), data, queries, metrics)
+	fmt.Fprintf(stdout, "products        %d\n", e.count)
+	fmt.Fprintf(stdout, "mse             %g\n", e.mse)
+	fmt.Fprintf(stdout, "normalized mse  %g\n", e.nmse)
+	fmt.Fprintf(stdout, "mean abs error  %g\n", e.meanAbs)
+	fmt.Fprintf(stdout, "max abs error   %g\n", e.maxAbs)
+	return nil
+}
+
+// evaluation holds the error metrics of an approximate product.
+type evaluation struct {
+	count   int
+	mse     float64
+	nmse    float64 // mse divided by the mean squared exact product
+	meanAbs float64
+	maxAbs  float64
+}
+
+// evaluate compares the approximate product with the exact dot products
+// (or squared distances, according to the metric of each query vector)
+// between each data example and each query vector.
+func evaluate(approx gomaddness.Matrix[float32], data, queries gomaddness.Vectors[float32], metrics []gomaddness.Metric) evaluation {
+	var e evaluation
+	var sumSquaredErr, sumSquaredExact float64
+	for i, x := range data {
+		row := approx.Row(i)
+		for j, q := range queries {
+			exact := float64(x.DotProduct(q))
+			if metrics[j] == gomaddness.MetricSquaredL2 {
+				exact = float64(x.SquaredDistance(q))
+			}
+			diff := math.Abs(float64(row[j]) - exact)
+			sumSquaredErr += diff * diff
+			sumSquaredExact += exact * exact
+			e.meanAbs += diff
+			e.maxAbs = math.Max(e.maxAbs, diff)
+			e.count++
+		}
+	}
+	if e.count > 0 {
+		e.mse = sumSquaredErr / float64(e.count)
+		e.meanAbs /= float64(e.count)
+	}
+	if sumSquaredExact > 0 {
+		e.nmse = sumSquaredErr / sumSquaredExact
+	}
+	return e
+}
@@ -0,0 +1,69 @@
+// Copyright 2022, NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/nlpodyssey/gomaddness"
+)
+
+func runInspect(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("inspect", "-model MODEL [-tree | -json]", stderr)
+	modelPath := fs.String("model", "", "model file")
+	tree := fs.Bool("tree", false, "print the hashing tree of each subspace")
+	asJSON := fs.Bool("json", false, "print the whole model as JSON")
+	if err := parseFlags(fs, args, "model"); err != nil {
+		return err
+	}
+
+	m, err := gomaddness.Load[float32](*modelPath)
+	if err != nil {
+		return err
+	}
+	switch {
+	case *asJSON:
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(m)
+	case *tree:
+		return m.Dump(stdout)
+	default:
+		printSummary(stdout, m)
+		return nil
+	}
+}
+
+func printSummary(w io.Writer, m *gomaddness.Maddness[float32]) {
+	numProtos := 0
+	if len(m.Encoders) > 0 {
+		numProtos = m.Encoders[0].NumCodes()
+	}
+	var maxError float32
+	for _, lut := range m.LookupTables {
+		if lut.MaxError > maxError {
+			maxError = lut.MaxError
+		}
+	}
+	fmt.Fprintf(w, "vector size      %d\n", m.VectorSize)
+	fmt.Fprintf(w, "subspaces        %d\n", m.NumSubspaces)
+	fmt.Fprintf(w, "sub-vector size  %d\n", m.SubVectorSize)
+	fmt.Fprintf(w, "prototypes       %d per subspace\n", numProtos)
+	fmt.Fprintf(w, "lookup tables    %d\n", len(m.LookupTables))
+	fmt.Fprintf(w, "aggregation      %s\n", m.Aggregation)
+	fmt.Fprintf(w, "scaling          %s\n", m.Scaling)
+	fmt.Fprintf(w, "precision        %s\n", m.Precision)
+	fmt.Fprintf(w, "rounding         %s\n", m.Rounding)
+	fmt.Fprintf(w, "random seed      %d\n", m.RandomSeed)
+	fmt.Fprintf(w, "partitioning     %s\n", m.Partitioning)
+	fmt.Fprintf(w, "encoding         %s\n", m.Encoding)
+	fmt.Fprintf(w, "assignment       %s\n", m.Assignment)
+	if m.Rotation != nil {
+		fmt.Fprintf(w, "rotation         %dx%d\n", len(m.Rotation), m.VectorSize)
+	}
+	fmt.Fprintf(w, "max lut error    %g\n", maxError)
+}
@@ -0,0 +1,129 @@
+// Copyright 2022, NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Command maddness trains, evaluates and inspects MADDNESS models.
+//
+// Usage:
+//
+//	maddness <command> [flags]
+//
+// The commands are:
+//
+//	train    train a new model from data examples and query vectors
+//	eval     report the error of a model against the exact product
+//	encode   write the codes (prototype indices) of a dataset
+//	matmul   write the approximate product of a dataset and the queries
+//	inspect  print a summary of a model
+//
+// Run "maddness <command> -h" for the flags of each command.
+//
+// Datasets are read from NumPy .npy files, or from CSV and TSV files (one
+// vector per line), according to the file extension, and they are written
+// to .npy or CSV files. Models are stored in the binary format of the
+// gomaddness package, with float32 values.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout, os.Stderr); err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(os.Stderr, errorMessage(err))
+		}
+		os.Exit(2)
+	}
+}
+
+// errorMessage returns the message of err prefixed with the name of the
+// tool, unless it already is, as for errors of the gomaddness package.
+func errorMessage(err error) string {
+	msg := err.Error()
+	if strings.HasPrefix(msg, "maddness: ") {
+		return msg
+	}
+	return "maddness: " + msg
+}
+
+// command is a subcommand of the tool.
+type command struct {
+	name  string
+	short string
+	run   func(args []string, stdout, stderr io.Writer) error
+}
+
+var commands = []command{
+	{"train", "train a new model from data examples and query vectors", runTrain},
+	{"eval", "report the error of a model against the exact product", runEval},
+	{"encode", "write the codes (prototype indices) of a dataset", runEncode},
+	{"matmul", "write the approximate product of a dataset and the queries", runMatMul},
+	{"inspect", "print a summary of a model", runInspect},
+}
+
+// run executes the command specified by args.
+func run(args []string, stdout, stderr io.Writer) error {
+	if len(args) == 0 {
+		usage(stderr)
+		return errors.New("missing command")
+	}
+	for _, c := range commands {
+		if c.name == args[0] {
+			return c.run(args[1:], stdout, stderr)
+		}
+	}
+	if args[0] == "help" || args[0] == "-h" || args[0] == "-help" || args[0] == "--help" {
+		usage(stdout)
+		return nil
+	}
+	usage(stderr)
+	return fmt.Errorf("unknown command %q", args[0])
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: maddness <command> [flags]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-8s %s\n", c.name, c.short)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, `Run "maddness <command> -h" for the flags of each command.`)
+}
+
+// newFlagSet creates the flag set of a command, reporting errors
+// instead of exiting.
+func newFlagSet(name, usage string, stderr io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: maddness %s %s\n\nFlags:\n", name, usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseFlags parses args, and checks that all the given required flags
+// are set, and not empty.
+func parseFlags(fs *flag.FlagSet, args []string, required ...string) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("%s: unexpected arguments %q", fs.Name(), fs.Args())
+	}
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	for _, name := range required {
+		if !set[name] || fs.Lookup(name).Value.String() == "" {
+			return fmt.Errorf("%s: missing required flag -%s", fs.Name(), name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+// Copyright 2022, NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nlpodyssey/gomaddness"
+	"github.com/nlpodyssey/gomaddness/npy"
+)
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	dataPath := filepath.Join(dir, "data.csv")
+	queriesPath := filepath.Join(dir, "queries.npy")
+	modelPath := filepath.Join(dir, "model.bin")
+
+	r := rand.New(rand.NewSource(1))
+	var csvData strings.Builder
+	for i := 0; i < 64; i++ {
+		for j := 0; j < 8; j++ {
+			if j > 0 {
+				csvData.WriteString(",")
+			}
+			fmt.Fprintf(&csvData, "%g", r.Float32())
+		}
+		csvData.WriteString("\n")
+	}
+	writeFile(t, dataPath, []byte(csvData.String()))
+
+	queries := make(gomaddness.Vectors[float32], 3)
+	for i := range queries {
+		queries[i] = make(gomaddness.Vector[float32], 8)
+		for j := range queries[i] {
+			queries[i][j] = r.Float32()
+		}
+	}
+	var npyQueries bytes.Buffer
+	if err := npy.WriteVectors(&npyQueries, queries); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, queriesPath, npyQueries.Bytes())
+
+	mustRun(t, "train", "-data", dataPath, "-queries", queriesPath, "-subspaces", "2",
+		"-o", modelPath, "-precision", "uint16", "-scaling", "per-subspace", "-partitioning", "correlated")
+
+	out := mustRun(t, "inspect", "-model", modelPath)
+	for _, s := range []string{"subspaces        2", "lookup tables    3", "precision        uint16", "scaling          per-subspace", "partitioning     correlated"} {
+		if !strings.Contains(out, s) {
+			t.Errorf("expected inspect output to contain %q, actual:\n%s", s, out)
+		}
+	}
+	if out := mustRun(t, "inspect", "-model", modelPath, "-tree"); !strings.Contains(out, "subspace 1, columns [") {
+		t.Errorf("unexpected tree output:\n%s", out)
+	}
+	if out := mustRun(t, "inspect", "-model", modelPath, "-json"); !strings.Contains(out, `"num_subspaces": 2`) {
+		t.Errorf("unexpected JSON output:\n%s", out)
+	}
+
+	out = mustRun(t, "eval", "-model", modelPath, "-data", dataPath, "-queries", queriesPath)
+	if !strings.Contains(out, "products        192") {
+		t.Errorf("unexpected eval output:\n%s", out)
+	}
+
+	if out := mustRun(t, "eval", "-model", modelPath, "-data", dataPath, "-queries", queriesPath, "-assignment", "nearest-prototype"); !strings.Contains(out, "products        192") {
+		t.Errorf("unexpected eval output with nearest-prototype assignment:\n%s", out)
+	}
+
+	out = mustRun(t, "encode", "-model", modelPath, "-data", dataPath)
+	if lines := strings.Split(strings.TrimSpace(out), "\n"); len(lines) != 64 || strings.Count(lines[0], ",") != 1 {
+		t.Errorf("unexpected encode output:\n%s", out)
+	}
+
+	headerPath := filepath.Join(dir, "header.tsv")
+	writeFile(t, headerPath, []byte("a\tb\tc\td\te\tf\tg\th\n"+strings.ReplaceAll(csvData.String(), ",", "\t")))
+	if out2 := mustRun(t, "encode", "-model", modelPath, "-data", headerPath, "-header"); out2 != out {
+		t.Errorf("expected the same codes from TSV data, actual:\n%s", out2)
+	}
+
+	productPath := filepath.Join(dir, "product.npy")
+	mustRun(t, "matmul", "-model", modelPath, "-data", dataPath, "-o", productPath)
+	f, err := os.Open(productPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	product, err := npy.ReadVectors[float32](f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(product) != 64 || len(product[0]) != 3 {
+		t.Errorf("expected 64x3 product, actual %dx%d", len(product), len(product[0]))
+	}
+
+	t.Run("bolt with rotation", func(t *testing.T) {
+		boltPath := filepath.Join(dir, "bolt.bin")
+		mustRun(t, "train", "-data", dataPath, "-queries", queriesPath, "-subspaces", "4",
+			"-o", boltPath, "-encoding", "bolt", "-scaling", "per-subspace", "-rotation", "2")
+		out := mustRun(t, "inspect", "-model", boltPath)
+		for _, s := range []string{"encoding         bolt", "rotation         8x8"} {
+			if !strings.Contains(out, s) {
+				t.Errorf("expected inspect output to contain %q, actual:\n%s", s, out)
+			}
+		}
+		if out := mustRun(t, "eval", "-model", boltPath, "-data", dataPath, "-queries", queriesPath); !strings.Contains(out, "products        192") {
+			t.Errorf("unexpected eval output:\n%s", out)
+		}
+	})
+
+	t.Run("squared distances", func(t *testing.T) {
+		l2Path := filepath.Join(dir, "l2.bin")
+		mustRun(t, "train", "-data", dataPath, "-queries", queriesPath, "-subspaces", "2",
+			"-o", l2Path, "-metric", "squared-l2", "-precision", "float32")
+		out := mustRun(t, "eval", "-model", l2Path, "-data", dataPath, "-queries", queriesPath)
+		if !strings.Contains(out, "products        192") {
+			t.Errorf("unexpected eval output:\n%s", out)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		for _, args := range [][]string{
+			nil,
+			{"unknown"},
+			{"train", "-data", dataPath},
+			{"train", "-data", dataPath, "-queries", queriesPath, "-subspaces", "9", "-o", modelPath},
+			{"train", "-data", dataPath, "-queries", queriesPath, "-subspaces", "2", "-o", modelPath, "-precision", "int4"},
+			{"train", "-data", dataPath, "-queries", queriesPath, "-subspaces", "2", "-o", modelPath, "-encoding", "pq", "-codes", "0"},
+			{"eval", "-model", modelPath, "-data", dataPath, "-queries", dataPath},
+			{"encode", "-model", dataPath, "-data", dataPath},
+			{"encode", "-model", modelPath, "-data", headerPath},
+			{"encode", "-model", modelPath, "-data", dataPath, "-assignment", "closest"},
+			{"inspect", "-model", modelPath, "extra"},
+		} {
+			if err := run(args, &bytes.Buffer{}, &bytes.Buffer{}); err == nil {
+				t.Errorf("expected error running %q", args)
+			}
+		}
+	})
+
+	t.Run("subspaces", func(t *testing.T) {
+		for expected, args := range map[string][]string{
+			"maddness: train: missing required flag -subspaces": {
+				"train", "-data", dataPath, "-queries", queriesPath, "-o", modelPath},
+			"maddness: train: invalid -subspaces -1 (it must be at least 1)": {
+				"train", "-data", dataPath, "-queries", queriesPath, "-subspaces", "-1", "-o", modelPath},
+		} {
+			err := run(args, &bytes.Buffer{}, &bytes.Buffer{})
+			if err == nil {
+				t.Errorf("expected error running %q", args)
+			} else if actual := errorMessage(err); actual != expected {
+				t.Errorf("expected message %q, actual %q", expected, actual)
+			}
+		}
+	})
+}
+
+func TestErrorMessage(t *testing.T) {
+	for _, tc := range []struct {
+		err      error
+		expected string
+	}{
+		{errors.New("missing command"), "maddness: missing command"},
+		{errors.New("maddness: invalid numSubspaces 0"), "maddness: invalid numSubspaces 0"},
+	} {
+		if actual := errorMessage(tc.err); actual != tc.expected {
+			t.Errorf("expected %q, actual %q", tc.expected, actual)
+		}
+	}
+}
+
+func mustRun(t *testing.T, args ...string) string {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	if err := run(args, &stdout, &stderr); err != nil {
+		t.Fatalf("%q: %v\n%s", args, err, stderr.String())
+	}
+	return stdout.String()
+}
+
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
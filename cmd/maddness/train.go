@@ -0,0 +1,99 @@
+// Copyright 2022, NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding"
+	"fmt"
+	"io"
+
+	"github.com/nlpodyssey/gomaddness"
+)
+
+func runTrain(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("train", "-data FILE -queries FILE -subspaces N -o MODEL [flags]", stderr)
+	dataPath := fs.String("data", "", "data examples (.npy or CSV)")
+	queriesPath := fs.String("queries", "", "query vectors (.npy or CSV)")
+	numSubspaces := fs.Int("subspaces", 0, "number of subspaces, not greater than the vector size")
+	output := fs.String("o", "", "output model file")
+	aggregation := gomaddness.AggregationExact
+	fs.Var(textValue{&aggregation}, "aggregation", "aggregation of lookup-table entries: exact or averaging")
+	scaling := gomaddness.ScalingGlobal
+	fs.Var(textValue{&scaling}, "scaling", "lookup-table scaling: global or per-subspace")
+	precision := gomaddness.PrecisionUint8
+	fs.Var(textValue{&precision}, "precision", "lookup-table precision: uint8, uint16, float16 or float32")
+	rounding := gomaddness.RoundingNearest
+	fs.Var(textValue{&rounding}, "rounding", "lookup-table rounding: nearest or stochastic")
+	partitioning := gomaddness.PartitioningContiguous
+	fs.Var(textValue{&partitioning}, "partitioning", "assignment of vector elements to subspaces: contiguous, variance-balanced or correlated")
+	encoding := gomaddness.EncodingHashTree
+	fs.Var(textValue{&encoding}, "encoding", "encoder of the sub-vectors: hash-tree, unbalanced-tree, pq or bolt (Bolt, best with -scaling per-subspace)")
+	codes := fs.Int("codes", 256, "number of prototypes per subspace, with pq encoding")
+	assignment := gomaddness.AssignmentEncoder
+	fs.Var(textValue{&assignment}, "assignment", "assignment of sub-vectors to prototypes: encoder or nearest-prototype")
+	metric := gomaddness.MetricDotProduct
+	fs.Var(textValue{&metric}, "metric", "metric of the lookup tables: dot-product or squared-l2")
+	rotation := fs.Int("rotation", 0, "iterations for learning a rotation of the vectors (OPQ), 0 for none")
+	seed := fs.Int64("seed", 1, "seed for the pseudo-random number generators")
+	csvOptions := addCSVFlags(fs)
+	if err := parseFlags(fs, args, "data", "queries", "subspaces", "o"); err != nil {
+		return err
+	}
+	if *numSubspaces < 1 {
+		return fmt.Errorf("train: invalid -subspaces %d (it must be at least 1)", *numSubspaces)
+	}
+
+	data, err := readVectors(*dataPath, csvOptions)
+	if err != nil {
+		return err
+	}
+	queries, err := readVectors(*queriesPath, csvOptions)
+	if err != nil {
+		return err
+	}
+	if *codes < 1 || *codes > 256 {
+		return fmt.Errorf("invalid number of codes %d (it must be between 1 and 256)", *codes)
+	}
+
+	opts := []gomaddness.Option{
+		gomaddness.WithAggregation(aggregation),
+		gomaddness.WithScaling(scaling),
+		gomaddness.WithPrecision(precision),
+		gomaddness.WithRounding(rounding),
+		gomaddness.WithRandomSeed(*seed),
+		gomaddness.WithPartitioning(partitioning),
+		gomaddness.WithEncoding(encoding),
+		gomaddness.WithNumCodes(*codes),
+		gomaddness.WithRotation(*rotation),
+		gomaddness.WithAssignment(assignment),
+		gomaddness.WithMetric(metric),
+	}
+	if err := gomaddness.ValidateTrainingData(data, queries, *numSubspaces, opts...); err != nil {
+		return err
+	}
+	m := gomaddness.TrainMaddness(data, queries, *numSubspaces, opts...)
+	return m.Save(*output)
+}
+
+// textValue is a flag.Value for types supporting text marshalling, such
+// as the settings of a model.
+type textValue struct {
+	p interface {
+		encoding.TextMarshaler
+		encoding.TextUnmarshaler
+	}
+}
+
+func (v textValue) String() string {
+	if v.p == nil {
+		return ""
+	}
+	text, _ := v.p.MarshalText()
+	return string(text)
+}
+
+func (v textValue) Set(s string) error {
+	return v.p.UnmarshalText([]byte(s))
+}
@@ -0,0 +1,298 @@
+// Copyright 2022, NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package csvdata loads datasets of vectors from CSV and TSV files,
+// validating them before they are used for training or inference.
+//
+// Each record of a file becomes a vector. All records must have the same
+// amount of fields, and all selected values must be finite numbers;
+// problems are reported as *Error values, carrying the line and the field
+// where they occur.
+package csvdata
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/nlpodyssey/gomaddness"
+)
+
+// MissingPolicy determines how missing values are handled.
+//
+// A value is missing when its field is empty, or when it is one of "NA",
+// "N/A", "NaN" or "null" (case-insensitive).
+type MissingPolicy uint8
+
+const (
+	// MissingError reports missing values as errors. It is the default.
+	MissingError MissingPolicy = iota
+	// MissingZero replaces missing values with zero.
+	MissingZero
+	// MissingMean replaces missing values with the mean of the
+	// non-missing values of the same column.
+	MissingMean
+	// MissingSkipRow drops the records containing missing values.
+	MissingSkipRow
+)
+
+// Options configures the loading of a dataset.
+type Options struct {
+	// Comma is the field delimiter. If zero, it is a comma, except for
+	// files with ".tsv" or ".tab" extension, opened by Load, which use
+	// a tab.
+	Comma rune
+	// Comment, if not zero, is the character starting comment lines,
+	// which are ignored.
+	Comment rune
+	// Header reports whether the first record is a header, containing
+	// the names of the columns, rather than data.
+	Header bool
+	// Columns are the zero-based indices of the columns to load, in the
+	// given order. If both Columns and ColumnNames are empty, all columns
+	// are loaded.
+	Columns []int
+	// ColumnNames are the names of the columns to load, in the given
+	// order, as found in the header. They require Header, and they are
+	// loaded after Columns.
+	ColumnNames []string
+	// Missing is the policy for missing values.
+	Missing MissingPolicy
+}
+
+var (
+	// ErrFieldCount is reported for a record whose amount of fields
+	// differs from the first record.
+	ErrFieldCount = errors.New("wrong number of fields")
+	// ErrMissingValue is reported for missing values, with MissingError.
+	ErrMissingValue = errors.New("missing value")
+	// ErrNonFinite is reported for infinite values.
+	ErrNonFinite = errors.New("non-finite value")
+)
+
+// Error is a problem found in the data, at a given position.
+type Error struct {
+	// Line is the one-based line where the problem occurs.
+	Line int
+	// Field is the one-based index of the field of the record, or zero if
+	// the problem concerns the whole record.
+	Field int
+	Err   error
+}
+
+func (e *Error) Error() string {
+	if e.Field == 0 {
+		return fmt.Sprintf("csvdata: line %d: %v", e.Line, e.Err)
+	}
+	return fmt.Sprintf("csvdata: line %d, field %d: %v", e.Line, e.Field, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Load reads a dataset from the CSV or TSV file at the given path.
+func Load[F gomaddness.Float](path string, o Options) (gomaddness.Vectors[F], error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if o.Comma == 0 {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".tsv", ".tab":
+			o.Comma = '\t'
+		}
+	}
+	return Read[F](f, o)
+}
+
+// Read reads a dataset from r.
+func Read[F gomaddness.Float](r io.Reader, o Options) (gomaddness.Vectors[F], error) {
+	cr := csv.NewReader(r)
+	if o.Comma != 0 {
+		cr.Comma = o.Comma
+	}
+	cr.Comment = o.Comment
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	cr.ReuseRecord = true
+
+	l := &loader[F]{o: o, cr: cr, numFields: -1}
+	if err := l.readHeader(); err != nil {
+		return nil, err
+	}
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := l.readRecord(record); err != nil {
+			return nil, err
+		}
+	}
+	if o.Missing == MissingMean {
+		l.fillMeans()
+	}
+	return l.vectors, nil
+}
+
+// loader holds the state of the loading of a dataset.
+type loader[F gomaddness.Float] struct {
+	o         Options
+	cr        *csv.Reader
+	numFields int
+	columns   []int
+	vectors   gomaddness.Vectors[F]
+	// missing are the positions of missing values, with MissingMean.
+	missing [][2]int
+}
+
+func (l *loader[F]) readHeader() error {
+	if !l.o.Header {
+		if len(l.o.ColumnNames) > 0 {
+			return errors.New("csvdata: column names require a header")
+		}
+		return nil
+	}
+	header, err := l.cr.Read()
+	if err == io.EOF {
+		return errors.New("csvdata: missing header")
+	}
+	if err != nil {
+		return err
+	}
+	if err := l.setNumFields(header); err != nil {
+		return err
+	}
+	for _, name := range l.o.ColumnNames {
+		index := -1
+		for i, h := range header {
+			if strings.TrimSpace(h) == name {
+				index = i
+				break
+			}
+		}
+		if index < 0 {
+			return fmt.Errorf("csvdata: column %q not found in header", name)
+		}
+		l.columns = append(l.columns, index)
+	}
+	return nil
+}
+
+// setNumFields sets the amount of fields of all records, and the columns
+// to load, from the first record.
+func (l *loader[F]) setNumFields(record []string) error {
+	l.numFields = len(record)
+	l.columns = make([]int, 0, len(l.o.Columns)+len(l.o.ColumnNames))
+	for _, c := range l.o.Columns {
+		if c < 0 || c >= l.numFields {
+			line, _ := l.cr.FieldPos(0)
+			return &Error{Line: line, Err: fmt.Errorf("column index %d out of range [0, %d)", c, l.numFields)}
+		}
+		l.columns = append(l.columns, c)
+	}
+	if len(l.o.Columns) == 0 && len(l.o.ColumnNames) == 0 {
+		for i := range record {
+			l.columns = append(l.columns, i)
+		}
+	}
+	return nil
+}
+
+func (l *loader[F]) readRecord(record []string) error {
+	if l.numFields < 0 {
+		if err := l.setNumFields(record); err != nil {
+			return err
+		}
+	}
+	if len(record) != l.numFields {
+		line, _ := l.cr.FieldPos(0)
+		return &Error{Line: line, Err: fmt.Errorf("%w: %d, expected %d", ErrFieldCount, len(record), l.numFields)}
+	}
+
+	v := make(gomaddness.Vector[F], len(l.columns))
+	var missing [][2]int
+	for i, c := range l.columns {
+		field := strings.TrimSpace(record[c])
+		if isMissing(field) {
+			switch l.o.Missing {
+			case MissingZero:
+				continue
+			case MissingMean:
+				missing = append(missing, [2]int{len(l.vectors), i})
+				continue
+			case MissingSkipRow:
+				return nil
+			default:
+				return l.fieldError(c, ErrMissingValue)
+			}
+		}
+		x, err := strconv.ParseFloat(field, 64)
+		if err != nil && !errors.Is(err, strconv.ErrRange) {
+			return l.fieldError(c, fmt.Errorf("invalid number %q", field))
+		}
+		if math.IsInf(x, 0) || math.IsInf(float64(F(x)), 0) {
+			return l.fieldError(c, ErrNonFinite)
+		}
+		v[i] = F(x)
+	}
+	l.vectors = append(l.vectors, v)
+	l.missing = append(l.missing, missing...)
+	return nil
+}
+
+func (l *loader[F]) fieldError(field int, err error) error {
+	line, _ := l.cr.FieldPos(field)
+	return &Error{Line: line, Field: field + 1, Err: err}
+}
+
+// fillMeans replaces the missing values with the mean of their columns.
+func (l *loader[F]) fillMeans() {
+	if len(l.missing) == 0 {
+		return
+	}
+	isMissing := make(map[[2]int]bool, len(l.missing))
+	for _, p := range l.missing {
+		isMissing[p] = true
+	}
+	means := make([]F, len(l.columns))
+	for j := range means {
+		var sum float64
+		n := 0
+		for i, v := range l.vectors {
+			if !isMissing[[2]int{i, j}] {
+				sum += float64(v[j])
+				n++
+			}
+		}
+		if n > 0 {
+			means[j] = F(sum / float64(n))
+		}
+	}
+	for _, p := range l.missing {
+		l.vectors[p[0]][p[1]] = means[p[1]]
+	}
+}
+
+// isMissing reports whether the trimmed field represents a missing value.
+func isMissing(field string) bool {
+	switch strings.ToLower(field) {
+	case "", "na", "n/a", "nan", "null":
+		return true
+	default:
+		return false
+	}
+}
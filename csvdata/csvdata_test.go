@@ -0,0 +1,121 @@
+// Copyright 2022, NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package csvdata
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nlpodyssey/gomaddness"
+)
+
+func TestRead(t *testing.T) {
+	t.Run("float32", testRead[float32])
+	t.Run("float64", testRead[float64])
+}
+
+func testRead[F gomaddness.Float](t *testing.T) {
+	const data = "a,b,c\n1, 2,3\n# comment\n4,NA,6\n7,8,\n"
+
+	testCases := []struct {
+		name     string
+		o        Options
+		expected gomaddness.Vectors[F]
+	}{
+		{
+			name:     "zero",
+			o:        Options{Header: true, Comment: '#', Missing: MissingZero},
+			expected: gomaddness.Vectors[F]{{1, 2, 3}, {4, 0, 6}, {7, 8, 0}},
+		},
+		{
+			name:     "mean",
+			o:        Options{Header: true, Comment: '#', Missing: MissingMean},
+			expected: gomaddness.Vectors[F]{{1, 2, 3}, {4, 5, 6}, {7, 8, 4.5}},
+		},
+		{
+			name:     "skip row",
+			o:        Options{Header: true, Comment: '#', Missing: MissingSkipRow},
+			expected: gomaddness.Vectors[F]{{1, 2, 3}},
+		},
+		{
+			name:     "columns",
+			o:        Options{Header: true, Comment: '#', Columns: []int{2}, ColumnNames: []string{"a"}, Missing: MissingZero},
+			expected: gomaddness.Vectors[F]{{3, 1}, {6, 4}, {0, 7}},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			vs, err := Read[F](strings.NewReader(data), tc.o)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(vs, tc.expected) {
+				t.Errorf("expected %v, actual %v", tc.expected, vs)
+			}
+		})
+	}
+
+	t.Run("tsv", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "data.tsv")
+		if err := os.WriteFile(path, []byte("1\t2\n3\t4\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		vs, err := Load[F](path, Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := gomaddness.Vectors[F]{{1, 2}, {3, 4}}
+		if !reflect.DeepEqual(vs, expected) {
+			t.Errorf("expected %v, actual %v", expected, vs)
+		}
+	})
+}
+
+func TestRead_errors(t *testing.T) {
+	t.Run("float32", testReadErrors[float32])
+	t.Run("float64", testReadErrors[float64])
+}
+
+func testReadErrors[F gomaddness.Float](t *testing.T) {
+	testCases := []struct {
+		data  string
+		o     Options
+		line  int
+		field int
+		err   error
+	}{
+		{data: "1,2\n3,4,5\n", line: 2, err: ErrFieldCount},
+		{data: "1,2\n3,\n", line: 2, field: 2, err: ErrMissingValue},
+		{data: "x,y\n1,2\n3,inf\n", o: Options{Header: true}, line: 3, field: 2, err: ErrNonFinite},
+		{data: "1,2\n1e400,4\n", line: 2, field: 1, err: ErrNonFinite},
+		{data: "1,2\n1,abc\n", line: 2, field: 2},
+		{data: "1,2\n", o: Options{Columns: []int{2}}, line: 1},
+	}
+	for _, tc := range testCases {
+		_, err := Read[F](strings.NewReader(tc.data), tc.o)
+		var e *Error
+		if !errors.As(err, &e) {
+			t.Errorf("%q: expected *Error, actual %v", tc.data, err)
+			continue
+		}
+		if e.Line != tc.line || e.Field != tc.field {
+			t.Errorf("%q: expected line %d, field %d, actual %v", tc.data, tc.line, tc.field, e)
+		}
+		if tc.err != nil && !errors.Is(err, tc.err) {
+			t.Errorf("%q: expected %v, actual %v", tc.data, tc.err, err)
+		}
+	}
+
+	if _, err := Read[F](strings.NewReader("1,2\n"), Options{ColumnNames: []string{"a"}}); err == nil {
+		t.Error("expected error with column names and no header")
+	}
+	if _, err := Read[F](strings.NewReader("a,b\n1,2\n"), Options{Header: true, ColumnNames: []string{"c"}}); err == nil {
+		t.Error("expected error with unknown column name")
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2022, NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gomaddness
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Dump writes a human-readable description of the model to w, meant
+// for debugging.
+//
+// The hashing tree (or unbalanced tree) of each subspace is printed as an
+// indented decision tree: each split refers to a column of the whole input
+// vector (after the rotation, if the model has one), and each leaf reports
+// its prototype index and the Euclidean norm of the prototype.
+// The encoders of other kinds are printed as the list of their prototypes'
+// norms. A summary of each lookup table follows.
+func (m *Maddness[F]) Dump(w io.Writer) error {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "maddness: %d subspaces, vector size %d, sub-vector size %d\n",
+		m.NumSubspaces, m.VectorSize, m.SubVectorSize)
+	fmt.Fprintf(&sb, "aggregation %s, scaling %s, precision %s, rounding %s, random seed %d\n",
+		m.Aggregation, m.Scaling, m.Precision, m.Rounding, m.RandomSeed)
+	if m.Permutation != nil {
+		fmt.Fprintf(&sb, "partitioning %s\n", m.Partitioning)
+	}
+	if m.Assignment != AssignmentEncoder {
+		fmt.Fprintf(&sb, "assignment %s\n", m.Assignment)
+	}
+	if m.Rotation != nil {
+		fmt.Fprintf(&sb, "rotation %dx%d\n", len(m.Rotation), m.VectorSize)
+	}
+	if m.Encoding != EncodingHashTree {
+		fmt.Fprintf(&sb, "encoding %s\n", m.Encoding)
+	}
+
+	for i, e := range m.Encoders {
+		begin, end := m.SubspaceBounds(i)
+		columns := make([]int, end-begin)
+		for j := range columns {
+			columns[j] = begin + j
+			if m.Permutation != nil {
+				columns[j] = m.Permutation[begin+j]
+			}
+		}
+		if m.Permutation == nil {
+			fmt.Fprintf(&sb, "subspace %d, columns [%d, %d):\n", i, begin, end)
+		} else {
+			fmt.Fprintf(&sb, "subspace %d, columns %v:\n", i, columns)
+		}
+		switch e := e.(type) {
+		case *Hash[F]:
+			dumpTreeNode(&sb, e, columns, 0, 0)
+			continue
+		case *UnbalancedTree[F]:
+			dumpUnbalancedTreeNode(&sb, e, columns, 0, 0)
+			continue
+		}
+		for j, p := range e.Prototypes() {
+			fmt.Fprintf(&sb, "  prototype %d, norm %g\n", j, p.Norm())
+		}
+	}
+
+	fmt.Fprintf(&sb, "lookup tables: %d\n", len(m.LookupTables))
+	for i, lut := range m.LookupTables {
+		fmt.Fprintf(&sb, "  %d: precision %s, bias %g, scale %g, max error %g, query norm %g",
+			i, lut.Precision, lut.Bias, lut.Scale, lut.MaxError, lut.QueryNorm)
+		if lut.Metric != MetricDotProduct {
+			fmt.Fprintf(&sb, ", metric %s", lut.Metric)
+		}
+		sb.WriteString("\n")
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// dumpTreeNode writes the node at the given level and index of the hashing
+// tree of h, and all its descendants. The columns are the indices of the
+// subspace's elements within the whole input vector.
+func dumpTreeNode[F Float](sb *strings.Builder, h *Hash[F], columns []int, level, index int) {
+	indent := strings.Repeat("  ", level+1)
+	if level == len(h.TreeLevels) {
+		fmt.Fprintf(sb, "%sprototype %d, norm %g\n", indent, index, h.Codebook[index].Norm())
+		return
+	}
+	column := columns[h.TreeLevels[level].SplitIndex]
+	threshold := h.TreeLevels[level].SplitThresholds[index]
+
+	fmt.Fprintf(sb, "%sx[%d] < %g:\n", indent, column, threshold)
+	dumpTreeNode(sb, h, columns, level+1, index*2)
+	fmt.Fprintf(sb, "%sx[%d] >= %g:\n", indent, column, threshold)
+	dumpTreeNode(sb, h, columns, level+1, index*2+1)
+}
+
+// dumpUnbalancedTreeNode writes the given child of an unbalanced tree t
+// (a node index, or a negative leaf reference), at the given depth, and
+// all its descendants.
+func dumpUnbalancedTreeNode[F Float](sb *strings.Builder, t *UnbalancedTree[F], columns []int, depth, child int) {
+	indent := strings.Repeat("  ", depth+1)
+	if child < 0 || len(t.Nodes) == 0 {
+		code := -child - 1
+		if len(t.Nodes) == 0 {
+			code = 0
+		}
+		fmt.Fprintf(sb, "%sprototype %d, norm %g\n", indent, code, t.Codebook[code].Norm())
+		return
+	}
+	node := t.Nodes[child]
+	column := columns[node.SplitIndex]
+
+	fmt.Fprintf(sb, "%sx[%d] < %g:\n", indent, column, node.SplitThreshold)
+	dumpUnbalancedTreeNode(sb, t, columns, depth+1, node.Children[0])
+	fmt.Fprintf(sb, "%sx[%d] >= %g:\n", indent, column, node.SplitThreshold)
+	dumpUnbalancedTreeNode(sb, t, columns, depth+1, node.Children[1])
+}
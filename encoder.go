@@ -0,0 +1,128 @@
+// Copyright 2022, NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gomaddness
+
+// Encoder maps the sub-vectors of a subspace to codes, each one
+// identifying a prototype vector.
+//
+// Hash, UnbalancedTree, PQEncoder and BoltEncoder are the implementations
+// used by Maddness, according to its Encoding.
+type Encoder[F Float] interface {
+	// Encode returns the code of the prototype assigned to v.
+	Encode(v Vector[F]) uint8
+	// Prototypes returns the prototype vectors, indexed by code.
+	Prototypes() Vectors[F]
+	// NumCodes returns the number of distinct codes, that is, the number
+	// of prototypes.
+	NumCodes() int
+}
+
+// Encoding identifies the kind of Encoder used for each subspace.
+type Encoding uint8
+
+const (
+	// EncodingHashTree uses the balanced binary regression trees of
+	// MADDNESS (Hash), with 16 prototypes.
+	EncodingHashTree Encoding = iota
+	// EncodingPQ uses classic product quantization (PQEncoder), assigning
+	// each sub-vector to its nearest k-means centroid.
+	EncodingPQ
+	// EncodingBolt uses the encoder of Bolt (BoltEncoder), assigning each
+	// sub-vector to its nearest k-means centroid, out of 16.
+	EncodingBolt
+	// EncodingUnbalancedTree uses binary regression trees whose leaves can
+	// be at different depths (UnbalancedTree), with 16 prototypes.
+	EncodingUnbalancedTree
+)
+
+// String returns a human-readable name of the encoding.
+func (e Encoding) String() string {
+	switch e {
+	case EncodingHashTree:
+		return "hash-tree"
+	case EncodingPQ:
+		return "pq"
+	case EncodingBolt:
+		return "bolt"
+	case EncodingUnbalancedTree:
+		return "unbalanced-tree"
+	default:
+		return "unknown"
+	}
+}
+
+// Assignment identifies the strategy used by Quantize for assigning
+// each sub-vector to a prototype.
+type Assignment uint8
+
+const (
+	// AssignmentEncoder assigns each sub-vector to the prototype chosen by
+	// the subspace's Encoder, such as the leaf of a hashing tree.
+	AssignmentEncoder Assignment = iota
+	// AssignmentNearestPrototype assigns each sub-vector to the prototype
+	// with the lowest Euclidean distance from it, regardless of the
+	// encoder. It is slower, but more accurate with trees.
+	AssignmentNearestPrototype
+)
+
+// String returns a human-readable name of the assignment strategy.
+func (a Assignment) String() string {
+	switch a {
+	case AssignmentEncoder:
+		return "encoder"
+	case AssignmentNearestPrototype:
+		return "nearest-prototype"
+	default:
+		return "unknown"
+	}
+}
+
+// newEncoder returns a new empty Encoder of the given kind, or nil if
+// the encoding is unknown.
+func newEncoder[F Float](e Encoding) Encoder[F] {
+	switch e {
+	case EncodingHashTree:
+		return new(Hash[F])
+	case EncodingPQ:
+		return new(PQEncoder[F])
+	case EncodingBolt:
+		return new(BoltEncoder[F])
+	case EncodingUnbalancedTree:
+		return new(UnbalancedTree[F])
+	default:
+		return nil
+	}
+}
+
+// encodingOf returns the Encoding of the given encoder, reporting whether
+// it is one of the kinds supported by Maddness.
+func encodingOf[F Float](e Encoder[F]) (Encoding, bool) {
+	switch e := e.(type) {
+	case *Hash[F]:
+		return EncodingHashTree, e != nil
+	case *PQEncoder[F]:
+		return EncodingPQ, e != nil
+	case *BoltEncoder[F]:
+		return EncodingBolt, e != nil
+	case *UnbalancedTree[F]:
+		return EncodingUnbalancedTree, e != nil
+	default:
+		return 0, false
+	}
+}
+
+// nearestPrototype returns the index of the prototype with the lowest
+// squared Euclidean distance from v.
+func nearestPrototype[F Float](protos Vectors[F], v Vector[F]) int {
+	best := 0
+	var bestDist F
+	for i, p := range protos {
+		dist := v.SquaredDistance(p)
+		if i == 0 || dist < bestDist {
+			best, bestDist = i, dist
+		}
+	}
+	return best
+}
@@ -0,0 +1,12 @@
+// Copyright 2022, NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+module github.com/nlpodyssey/gomaddness/gonum
+
+go 1.18
+
+require (
+	github.com/nlpodyssey/gomaddness v0.0.0-20261018171203-81c78e8b0f2e
+	gonum.org/v1/gonum v0.13.0
+)
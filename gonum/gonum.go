@@ -0,0 +1,215 @@
+// Copyright 2022, NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package gonum provides interoperability between gomaddness and the
+// gonum.org/v1/gonum/mat package, keeping the core gomaddness package
+// free from external dependencies.
+//
+// Following the usual matrix multiplication A·W, data vectors are the rows
+// of a matrix A, and query vectors are the columns of a weight matrix W.
+package gonum
+
+import (
+	"github.com/nlpodyssey/gomaddness"
+	"gonum.org/v1/gonum/mat"
+)
+
+// Train runs gomaddness.TrainMaddness, using the rows of a as data
+// examples, and the columns of w as query vectors.
+func Train[F gomaddness.Float](a, w mat.Matrix, numSubspaces int, opts ...gomaddness.Option) *gomaddness.Maddness[F] {
+	return gomaddness.TrainMaddness(Rows[F](a), Rows[F](w.T()), numSubspaces, opts...)
+}
+
+// Rows converts each row of a into a new gomaddness.Vector.
+func Rows[F gomaddness.Float](a mat.Matrix) gomaddness.Vectors[F] {
+	r, c := a.Dims()
+	vs := make(gomaddness.Vectors[F], r)
+	for i := range vs {
+		v := make(gomaddness.Vector[F], c)
+		for j := range v {
+			v[j] = F(a.At(i, j))
+		}
+		vs[i] = v
+	}
+	return vs
+}
+
+// NewDense creates a new *mat.Dense, whose rows are copied from vs.
+func NewDense[F gomaddness.Float](vs gomaddness.Vectors[F]) *mat.Dense {
+	if len(vs) == 0 {
+		panic("gonum: invalid empty vectors")
+	}
+	c := len(vs[0])
+	data := make([]float64, 0, len(vs)*c)
+	for _, v := range vs {
+		if len(v) != c {
+			panic("gonum: vectors of different length")
+		}
+		for _, x := range v {
+			data = append(data, float64(x))
+		}
+	}
+	return mat.NewDense(len(vs), c, data)
+}
+
+// Mul computes the approximate product A·W between the data matrix a and
+// the weight matrix W whose columns are the query vectors of the model m,
+// and stores the result in dst.
+//
+// As in gomaddness.Maddness.MatMul, the columns of lookup tables with
+// gomaddness.MetricSquaredL2 hold the approximated squared distances
+// instead of the dot products.
+//
+// If dst is empty, it is resized to the correct dimensions, otherwise
+// its dimensions must match the result, or Mul panics.
+func Mul[F gomaddness.Float](dst *mat.Dense, a mat.Matrix, m *gomaddness.Maddness[F]) {
+	r, _ := a.Dims()
+	c := len(m.LookupTables)
+	if dst.IsEmpty() {
+		dst.ReuseAs(r, c)
+	} else if dr, dc := dst.Dims(); dr != r || dc != c {
+		panic(mat.ErrShape)
+	}
+
+	v := make(gomaddness.Vector[F], m.VectorSize)
+	for i := 0; i < r; i++ {
+		lutIndices := lookupTableIndices(m, a, i, v)
+		for j := 0; j < c; j++ {
+			dst.Set(i, j, float64(approximate(m, lutIndices, j)))
+		}
+	}
+}
+
+// Weight exposes a trained model as the weight matrix W, whose columns are
+// the model's query vectors. It implements mat.Matrix, so that it can be
+// used wherever a weight matrix is expected: its elements are read from
+// the exact matrix W it holds, while MulTo and Product compute the
+// approximate product A·W with the model.
+type Weight[F gomaddness.Float] struct {
+	Model *gomaddness.Maddness[F]
+	// W is the exact weight matrix, whose columns are the query vectors
+	// the model was trained with.
+	W mat.Matrix
+}
+
+// NewWeight creates a new Weight from a model and the exact weight matrix
+// whose columns are the model's query vectors.
+//
+// It panics if the dimensions of w do not match the model.
+func NewWeight[F gomaddness.Float](m *gomaddness.Maddness[F], w mat.Matrix) Weight[F] {
+	if r, c := w.Dims(); r != m.VectorSize || c != len(m.LookupTables) {
+		panic(mat.ErrShape)
+	}
+	return Weight[F]{Model: m, W: w}
+}
+
+// A Multiplier computes the product between a matrix and a weight matrix
+// it holds, storing the result into dst.
+//
+// It is implemented by Weight, for approximate products, and by
+// ExactWeight, for exact ones, so that the two can be swapped.
+type Multiplier interface {
+	MulTo(dst *mat.Dense, a mat.Matrix)
+}
+
+var (
+	_ mat.Matrix = Weight[float32]{}
+	_ Multiplier = Weight[float32]{}
+	_ Multiplier = ExactWeight{}
+)
+
+// Dims returns the dimensions of W: the size of the query vectors, and
+// the amount of query vectors.
+func (w Weight[F]) Dims() (r, c int) {
+	return w.Model.VectorSize, len(w.Model.LookupTables)
+}
+
+// At returns the exact element of W at row i and column j, that is the
+// i-th element of the j-th query vector.
+func (w Weight[F]) At(i, j int) float64 {
+	return w.W.At(i, j)
+}
+
+// T returns the transpose of W.
+func (w Weight[F]) T() mat.Matrix {
+	return mat.Transpose{Matrix: w}
+}
+
+// MulTo computes the approximate product A·W and stores it in dst.
+// It is equivalent to Mul(dst, a, w.Model).
+func (w Weight[F]) MulTo(dst *mat.Dense, a mat.Matrix) {
+	Mul(dst, a, w.Model)
+}
+
+// Product returns a lazily evaluated mat.Matrix, holding the approximate
+// product A·W. The rows of a are quantized immediately, while each
+// dot product (or squared distance, see Mul) is only computed when
+// accessed with At.
+func (w Weight[F]) Product(a mat.Matrix) mat.Matrix {
+	r, _ := a.Dims()
+	p := &product[F]{
+		model:      w.Model,
+		lutIndices: make([][]uint16, r),
+	}
+	v := make(gomaddness.Vector[F], w.Model.VectorSize)
+	for i := range p.lutIndices {
+		p.lutIndices[i] = lookupTableIndices(w.Model, a, i, v)
+	}
+	return p
+}
+
+// ExactWeight wraps a mat.Matrix, computing exact products A·W.
+type ExactWeight struct {
+	W mat.Matrix
+}
+
+// MulTo computes the exact product A·W and stores it in dst.
+func (w ExactWeight) MulTo(dst *mat.Dense, a mat.Matrix) {
+	dst.Mul(a, w.W)
+}
+
+// product is the lazily evaluated mat.Matrix returned by Weight.Product.
+type product[F gomaddness.Float] struct {
+	model      *gomaddness.Maddness[F]
+	lutIndices [][]uint16
+}
+
+// Dims returns the dimensions of the product.
+func (p *product[F]) Dims() (r, c int) {
+	return len(p.lutIndices), len(p.model.LookupTables)
+}
+
+// At returns the approximate dot product between the i-th data vector and
+// the j-th query vector, or their squared distance, according to the
+// metric of the j-th lookup table.
+func (p *product[F]) At(i, j int) float64 {
+	return float64(approximate(p.model, p.lutIndices[i], j))
+}
+
+// T returns the transpose of the product.
+func (p *product[F]) T() mat.Matrix {
+	return mat.Transpose{Matrix: p}
+}
+
+// approximate returns the approximated dot product between the data vector
+// identified by lutIndices and the j-th query vector, or their squared
+// distance, according to the metric of the j-th lookup table.
+func approximate[F gomaddness.Float](m *gomaddness.Maddness[F], lutIndices []uint16, j int) F {
+	if m.LookupTables[j].Metric == gomaddness.MetricSquaredL2 {
+		return m.Distance(lutIndices, j)
+	}
+	return m.DotProduct(lutIndices, j)
+}
+
+// lookupTableIndices copies the i-th row of a into v, and returns its
+// lookup-table indices.
+func lookupTableIndices[F gomaddness.Float](m *gomaddness.Maddness[F], a mat.Matrix, i int, v gomaddness.Vector[F]) []uint16 {
+	if _, c := a.Dims(); c != len(v) {
+		panic(mat.ErrShape)
+	}
+	for j := range v {
+		v[j] = F(a.At(i, j))
+	}
+	return m.LookupTableIndices(m.Quantize(v))
+}
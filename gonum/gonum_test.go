@@ -0,0 +1,134 @@
+// Copyright 2022, NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gonum
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/nlpodyssey/gomaddness"
+	"gonum.org/v1/gonum/mat"
+)
+
+func TestMul(t *testing.T) {
+	t.Run("float32", testMul[float32])
+	t.Run("float64", testMul[float64])
+}
+
+func testMul[F gomaddness.Float](t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	a := mat.NewDense(128, 16, nil)
+	a.Apply(func(_, _ int, _ float64) float64 { return r.NormFloat64() }, a)
+	w := mat.NewDense(16, 3, nil)
+	w.Apply(func(_, _ int, _ float64) float64 { return r.NormFloat64() }, w)
+
+	m := Train[F](a, w, 4)
+	if len(m.LookupTables) != 3 {
+		t.Fatalf("expected 3 lookup tables, actual %d", len(m.LookupTables))
+	}
+
+	var approx, exact mat.Dense
+	var weight Multiplier = NewWeight(m, w)
+	weight.MulTo(&approx, a)
+	ExactWeight{W: w}.MulTo(&exact, a)
+
+	if r, c := approx.Dims(); r != 128 || c != 3 {
+		t.Fatalf("expected 128×3 result, actual %d×%d", r, c)
+	}
+
+	// The approximate product can only be as accurate as the product
+	// between the reconstructed data vectors and W.
+	reconstructed := make(gomaddness.Vectors[F], 128)
+	for i, v := range Rows[F](a) {
+		reconstructed[i] = m.Reconstruct(m.Quantize(v))
+	}
+	var expected mat.Dense
+	ExactWeight{W: w}.MulTo(&expected, NewDense(reconstructed))
+
+	var diff mat.Dense
+	diff.Sub(&approx, &expected)
+	relErr := mat.Norm(&diff, 2) / mat.Norm(&expected, 2)
+	diff.Sub(&approx, &exact)
+	t.Logf("relative error: %g (vs. reconstructed), %g (vs. exact)",
+		relErr, mat.Norm(&diff, 2)/mat.Norm(&exact, 2))
+	if relErr > 0.05 {
+		t.Errorf("relative error %v is too large", relErr)
+	}
+
+	p := NewWeight(m, w).Product(a)
+	if !mat.Equal(p, &approx) {
+		t.Error("lazy product differs from Mul result")
+	}
+	if pt := p.T(); pt.At(2, 5) != approx.At(5, 2) {
+		t.Error("transposed lazy product differs from Mul result")
+	}
+
+	t.Run("weight matrix", func(t *testing.T) {
+		var weight mat.Matrix = NewWeight(m, w)
+		if !mat.Equal(weight, w) || !mat.Equal(weight.T(), w.T()) {
+			t.Error("expected the elements of the exact weight matrix")
+		}
+		// Used as a plain mat.Matrix, the weight gives the exact product.
+		var product mat.Dense
+		product.Mul(a, weight)
+		if !mat.EqualApprox(&product, &exact, 1e-12) {
+			t.Error("expected the exact product")
+		}
+	})
+
+	t.Run("squared distances", func(t *testing.T) {
+		m := Train[F](a, w, 4, gomaddness.WithQueryMetrics(
+			gomaddness.MetricSquaredL2, gomaddness.MetricDotProduct, gomaddness.MetricSquaredL2))
+		var approx mat.Dense
+		Mul(&approx, a, m)
+		// The columns of squared-L2 lookup tables hold the distances.
+		expected := m.MatMulVectors(Rows[F](a))
+		for i := 0; i < expected.Rows; i++ {
+			for j, x := range expected.Row(i) {
+				if actual := approx.At(i, j); actual != float64(x) {
+					t.Fatalf("(%d, %d): expected %v, actual %v", i, j, x, actual)
+				}
+			}
+		}
+		if p := NewWeight(m, w).Product(a); !mat.Equal(p, &approx) {
+			t.Error("lazy product differs from Mul result")
+		}
+	})
+
+	t.Run("weight dimensions mismatch", func(t *testing.T) {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected panic")
+			}
+		}()
+		NewWeight(m, w.T())
+	})
+
+	t.Run("dimensions mismatch", func(t *testing.T) {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected panic")
+			}
+		}()
+		Mul(mat.NewDense(2, 2, nil), a, m)
+	})
+}
+
+func TestRowsAndNewDense(t *testing.T) {
+	a := mat.NewDense(2, 3, []float64{1, 2, 3, 4, 5, 6})
+	vs := Rows[float32](a)
+	expected := gomaddness.Vectors[float32]{{1, 2, 3}, {4, 5, 6}}
+	for i := range expected {
+		for j := range expected[i] {
+			if vs[i][j] != expected[i][j] {
+				t.Fatalf("expected %v, actual %v", expected, vs)
+			}
+		}
+	}
+	if d := NewDense(vs); !mat.EqualApprox(d, a, math.SmallestNonzeroFloat64) {
+		t.Errorf("expected %v, actual %v", mat.Formatted(a), mat.Formatted(d))
+	}
+}
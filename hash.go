@@ -8,16 +8,17 @@ import "math"
 
 // Hash is the data structure for MADDNESS hash function.
 // It holds the learned balanced binary regression tree and the prototype
-// vectors.
+// vectors, and it implements Encoder.
 type Hash[F Float] struct {
-	TreeLevels []*HashingTreeLevel[F]
-	Prototypes Vectors[F]
+	TreeLevels []*HashingTreeLevel[F] `json:"tree_levels"`
+	// Codebook holds the prototype vectors, one for each leaf of the tree.
+	Codebook Vectors[F] `json:"prototypes"`
 }
 
 // HashingTreeLevel is one level of the binary tree from a Hash.
 type HashingTreeLevel[F Float] struct {
-	SplitIndex      int
-	SplitThresholds Vector[F]
+	SplitIndex      int       `json:"split_index"`
+	SplitThresholds Vector[F] `json:"split_thresholds"`
 }
 
 // TrainHash runs the learning process for MADDNESS hash function parameters,
@@ -38,7 +39,7 @@ func TrainHash[F Float](examples Vectors[F]) *Hash[F] {
 
 	return &Hash[F]{
 		TreeLevels: levels,
-		Prototypes: buckets.Prototypes(),
+		Codebook:   buckets.Prototypes(),
 	}
 }
 
@@ -56,6 +57,21 @@ func (h *Hash[F]) Hash(v Vector[F]) uint8 {
 	return i - 1
 }
 
+// Encode is the same as Hash, implementing Encoder.
+func (h *Hash[F]) Encode(v Vector[F]) uint8 {
+	return h.Hash(v)
+}
+
+// Prototypes returns the prototype vectors of the leaves of the tree.
+func (h *Hash[F]) Prototypes() Vectors[F] {
+	return h.Codebook
+}
+
+// NumCodes returns the number of leaves of the tree.
+func (h *Hash[F]) NumCodes() int {
+	return len(h.Codebook)
+}
+
 func nextHashingTreeLevel[F Float](buckets Buckets[F]) (Buckets[F], *HashingTreeLevel[F]) {
 	indices := buckets.HeuristicSelectIndices()
 
@@ -44,7 +44,7 @@ func testTrainHash[F Float](t *testing.T) {
 		t.Logf("\t\tLevel %d: %+v", i, *l)
 	}
 	t.Logf("\tPrototypes:")
-	for i, p := range h.Prototypes {
+	for i, p := range h.Codebook {
 		t.Logf("\t\tPrototype %d: %v", i, p)
 	}
 
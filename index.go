@@ -0,0 +1,209 @@
+// Copyright 2022, NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gomaddness
+
+import (
+	"container/heap"
+	"fmt"
+	"sort"
+)
+
+// Index stores the quantized codes of a database of vectors, and answers
+// top-k maximum inner product or nearest squared Euclidean distance
+// queries, approximated with lookup tables built for each query.
+//
+// The original vectors can optionally be kept, for re-ranking the best
+// candidates with the exact metric.
+type Index[F Float] struct {
+	model       *Maddness[F]
+	lutIndices  [][]uint16
+	vectors     Vectors[F]
+	keepVectors bool
+}
+
+// SearchResult is a vector of an Index, found by Index.Search.
+type SearchResult[F Float] struct {
+	// The position of the vector in the Index, in order of addition.
+	Index int
+	// The (approximated or exact) dot product with the query, or squared
+	// distance from it, according to the metric of the search.
+	Score F
+}
+
+// NewIndex creates a new empty Index of vectors quantized by m.
+//
+// If keepVectors is true, the vectors added to the index are also kept,
+// without being copied, allowing Search to re-rank the candidates.
+func NewIndex[F Float](m *Maddness[F], keepVectors bool) *Index[F] {
+	return &Index[F]{
+		model:       m,
+		keepVectors: keepVectors,
+	}
+}
+
+// Add quantizes the given vectors and adds them to the index.
+//
+// It panics if the size of a vector differs from the model's VectorSize.
+func (ix *Index[F]) Add(vs ...Vector[F]) {
+	for _, v := range vs {
+		ix.lutIndices = append(ix.lutIndices, ix.model.LookupTableIndices(ix.model.Quantize(v)))
+		if ix.keepVectors {
+			ix.vectors = append(ix.vectors, v)
+		}
+	}
+}
+
+// Len returns the number of vectors in the index.
+func (ix *Index[_]) Len() int {
+	return len(ix.lutIndices)
+}
+
+// Search returns the k vectors of the index with the highest dot product
+// with the query vector, or with the smallest squared distance from it,
+// according to metric, best first.
+//
+// Scores are approximated with a lookup table built for the query, with
+// the model's scaling, precision and rounding. If rerank is greater than
+// zero, the best max(k, rerank) candidates are re-ranked with their exact
+// scores, which requires the index to keep the original vectors.
+//
+// If k is greater than Len, only Len results are returned, and if k is
+// zero, none. A zero rerank disables re-ranking.
+//
+// It panics if the size of query differs from the model's VectorSize, if
+// metric is invalid, if k or rerank is negative, or if re-ranking is
+// requested without vectors.
+func (ix *Index[F]) Search(query Vector[F], k int, metric Metric, rerank int) []SearchResult[F] {
+	if k < 0 {
+		panic(fmt.Sprintf("maddness: invalid negative k %d", k))
+	}
+	if rerank < 0 {
+		panic(fmt.Sprintf("maddness: invalid negative rerank %d", rerank))
+	}
+	if len(query) != ix.model.VectorSize {
+		panic(fmt.Sprintf("maddness: query vector has size %d, expected %d", len(query), ix.model.VectorSize))
+	}
+	if metric != MetricDotProduct && metric != MetricSquaredL2 {
+		panic(fmt.Sprintf("maddness: invalid metric %d", metric))
+	}
+	if rerank > 0 && !ix.keepVectors {
+		panic("maddness: cannot re-rank an index without vectors")
+	}
+
+	n := k
+	if rerank > n {
+		n = rerank
+	}
+	lut := ix.model.makeLookupTable(query, metric, ix.model.RandomSeed)
+	h := newResultHeap[F](n, metric)
+	for i, lutIndices := range ix.lutIndices {
+		h.offer(i, ix.model.approximate(lutIndices, lut))
+	}
+
+	if rerank > 0 {
+		for i, r := range h.results {
+			v := ix.vectors[r.Index]
+			if metric == MetricSquaredL2 {
+				h.results[i].Score = v.SquaredDistance(query)
+			} else {
+				h.results[i].Score = v.DotProduct(query)
+			}
+		}
+	}
+
+	h.sort()
+	results := h.results
+	if len(results) > k {
+		results = results[:k]
+	}
+	return results
+}
+
+// resultHeap keeps the best n results offered, with the worst one
+// at the root.
+type resultHeap[F Float] struct {
+	results []SearchResult[F]
+	n       int
+	metric  Metric
+}
+
+func newResultHeap[F Float](n int, metric Metric) *resultHeap[F] {
+	return &resultHeap[F]{
+		results: make([]SearchResult[F], 0, n),
+		n:       n,
+		metric:  metric,
+	}
+}
+
+// better reports whether score a is strictly better than b.
+func (h *resultHeap[F]) better(a, b F) bool {
+	if h.metric == MetricSquaredL2 {
+		return a < b
+	}
+	return a > b
+}
+
+// offer adds the result to the heap if it is one of the best n so far.
+// Ties are resolved in favor of the results offered first.
+func (h *resultHeap[F]) offer(index int, score F) {
+	if h.n <= 0 {
+		return
+	}
+	if len(h.results) < h.n {
+		heap.Push(h, SearchResult[F]{Index: index, Score: score})
+		return
+	}
+	if h.better(score, h.results[0].Score) {
+		h.results[0] = SearchResult[F]{Index: index, Score: score}
+		heap.Fix(h, 0)
+	}
+}
+
+// worst returns the score of the worst result, reporting false if the
+// heap does not hold n results yet, or if n is not positive.
+func (h *resultHeap[F]) worst() (F, bool) {
+	if h.n <= 0 || len(h.results) < h.n {
+		return 0, false
+	}
+	return h.results[0].Score, true
+}
+
+// sort sorts the results best first, breaking the heap order.
+func (h *resultHeap[_]) sort() {
+	sort.SliceStable(h.results, func(i, j int) bool {
+		return h.Less(j, i)
+	})
+}
+
+// Len is the number of results in the heap.
+func (h *resultHeap[_]) Len() int {
+	return len(h.results)
+}
+
+// Less reports whether the result at i is worse than the result at j.
+func (h *resultHeap[_]) Less(i, j int) bool {
+	a, b := h.results[i], h.results[j]
+	if a.Score == b.Score {
+		return a.Index > b.Index
+	}
+	return h.better(b.Score, a.Score)
+}
+
+// Swap swaps the i-th and j-th results.
+func (h *resultHeap[_]) Swap(i, j int) {
+	h.results[i], h.results[j] = h.results[j], h.results[i]
+}
+
+// Push adds x, which must be a SearchResult, to the heap.
+func (h *resultHeap[F]) Push(x any) {
+	h.results = append(h.results, x.(SearchResult[F]))
+}
+
+// Pop removes and returns the last result of the heap.
+func (h *resultHeap[_]) Pop() any {
+	last := h.results[len(h.results)-1]
+	h.results = h.results[:len(h.results)-1]
+	return last
+}
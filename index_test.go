@@ -0,0 +1,99 @@
+// Copyright 2022, NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gomaddness
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestIndex_Search(t *testing.T) {
+	t.Run("float32", testIndexSearch[float32])
+	t.Run("float64", testIndexSearch[float64])
+}
+
+func testIndexSearch[F Float](t *testing.T) {
+	examples, queryVectors := randomExamples[F](256, 12, 2)
+	m := TrainMaddness(examples, queryVectors, 3)
+
+	ix := NewIndex(m, true)
+	ix.Add(examples...)
+	if ix.Len() != len(examples) {
+		t.Fatalf("expected Len %d, actual %d", len(examples), ix.Len())
+	}
+
+	// The query is not one of the training-time query vectors.
+	query := examples[100]
+
+	for _, metric := range []Metric{MetricDotProduct, MetricSquaredL2} {
+		t.Run(metric.String(), func(t *testing.T) {
+			lut := m.makeLookupTable(query, metric, m.RandomSeed)
+			results := ix.Search(query, 10, metric, 0)
+			if len(results) != 10 {
+				t.Fatalf("expected 10 results, actual %d", len(results))
+			}
+			for i, r := range results {
+				if expected := m.approximate(m.LookupTableIndices(m.Quantize(examples[r.Index])), lut); r.Score != expected {
+					t.Errorf("result %d: expected score %v, actual %v", i, expected, r.Score)
+				}
+				if i > 0 && isBetter(metric, r.Score, results[i-1].Score) {
+					t.Errorf("result %d: score %v better than previous %v", i, r.Score, results[i-1].Score)
+				}
+			}
+
+			// Re-ranking all the vectors gives the exact results.
+			exact := make([]SearchResult[F], len(examples))
+			for i, x := range examples {
+				exact[i] = SearchResult[F]{Index: i, Score: x.DotProduct(query)}
+				if metric == MetricSquaredL2 {
+					exact[i].Score = x.SquaredDistance(query)
+				}
+			}
+			sort.SliceStable(exact, func(i, j int) bool {
+				return isBetter(metric, exact[i].Score, exact[j].Score)
+			})
+			reranked := ix.Search(query, 5, metric, len(examples))
+			for i, r := range reranked {
+				if r != exact[i] {
+					t.Errorf("re-ranked result %d: expected %v, actual %v", i, exact[i], r)
+				}
+			}
+		})
+	}
+
+	if results := ix.Search(query, 1000, MetricDotProduct, 0); len(results) != len(examples) {
+		t.Errorf("expected %d results, actual %d", len(examples), len(results))
+	}
+
+	if results := ix.Search(query, 0, MetricDotProduct, 4); len(results) != 0 {
+		t.Errorf("expected no results, actual %d", len(results))
+	}
+
+	for name, f := range map[string]func(){
+		"re-ranking without vectors": func() {
+			ix := NewIndex(m, false)
+			ix.Add(examples[:8]...)
+			ix.Search(query, 1, MetricDotProduct, 4)
+		},
+		"negative k":      func() { ix.Search(query, -1, MetricDotProduct, 0) },
+		"negative rerank": func() { ix.Search(query, 1, MetricDotProduct, -1) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("expected panic")
+				}
+			}()
+			f()
+		})
+	}
+}
+
+func isBetter[F Float](metric Metric, a, b F) bool {
+	if metric == MetricSquaredL2 {
+		return a < b
+	}
+	return a > b
+}
@@ -0,0 +1,25 @@
+// Copyright 2022, NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package endian detects the byte order of the host.
+package endian
+
+import (
+	"encoding/binary"
+	"unsafe"
+)
+
+// IsLittle reports whether the host is little-endian.
+var IsLittle = func() bool {
+	x := uint16(1)
+	return *(*byte)(unsafe.Pointer(&x)) == 1
+}()
+
+// Native returns the byte order of the host.
+func Native() binary.ByteOrder {
+	if IsLittle {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}
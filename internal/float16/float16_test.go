@@ -0,0 +1,55 @@
+// Copyright 2022, NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package float16
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFloat16(t *testing.T) {
+	testCases := []struct {
+		f    float32
+		bits uint16
+	}{
+		{0, 0x0000},
+		{float32(math.Copysign(0, -1)), 0x8000},
+		{1, 0x3c00},
+		{-2, 0xc000},
+		{0.5, 0x3800},
+		{65504, 0x7bff},                 // max normal
+		{6.1035156e-05, 0x0400},         // min normal
+		{5.9604645e-08, 0x0001},         // min subnormal
+		{float32(math.Inf(1)), 0x7c00},  // +Inf
+		{float32(math.Inf(-1)), 0xfc00}, // -Inf
+		{1 + 1.0/1024, 0x3c01},          // exactly representable
+		{1 + 1.0/2048, 0x3c00},          // tie, rounded to even
+		{1 + 3.0/2048, 0x3c02},          // tie, rounded to even
+		{65520, 0x7c00},                 // overflow
+		{1e-10, 0x0000},                 // underflow
+		{2.9802322e-08 * 3, 0x0002},     // subnormal rounding
+		{65519, 0x7bff},                 // rounded down to max normal
+	}
+	for _, tc := range testCases {
+		if actual := FromFloat32(tc.f); actual != tc.bits {
+			t.Errorf("FromFloat32(%v): expected %#04x, actual %#04x", tc.f, tc.bits, actual)
+		}
+	}
+
+	t.Run("round trip", func(t *testing.T) {
+		for h := 0; h <= math.MaxUint16; h++ {
+			f := ToFloat32(uint16(h))
+			if f != f {
+				if back := FromFloat32(f); back&0x7c00 != 0x7c00 || back&0x3ff == 0 {
+					t.Fatalf("NaN %#04x became %#04x", h, back)
+				}
+				continue
+			}
+			if back := FromFloat32(f); back != uint16(h) {
+				t.Fatalf("%#04x → %v → %#04x", h, f, back)
+			}
+		}
+	})
+}
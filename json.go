@@ -0,0 +1,234 @@
+// Copyright 2022, NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gomaddness
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// The JSON representation of a model follows the field tags of Maddness,
+// Hash and HashingTreeLevel, while aggregation, scaling, precision,
+// rounding, partitioning, encoding and assignment are encoded by name
+// (see their String methods).
+//
+// The lookup tables are represented as follows, where "data" holds the
+// table's elements (not their raw bytes), in row-major order:
+//
+//	{
+//	  "metric": "dot-product",
+//	  "precision": "uint8",
+//	  "bias": 0.5,
+//	  "scale": 12.3,
+//	  "offsets": [0.1, 0.2],
+//	  "max_error": 0.04,
+//	  "query_norm": 7.5,
+//	  "data": [0, 255, 17, 3]
+//	}
+//
+// The "offsets" are only present with ScalingPerSubspace. A missing
+// "metric" means "dot-product".
+//
+// The encoders are represented according to the field tags of their
+// types, which is determined by the model's "encoding".
+
+// maddnessFields has the same fields of Maddness, without its methods.
+type maddnessFields[F Float] Maddness[F]
+
+// maddnessJSON is used for unmarshalling a Maddness, whose encoders
+// are decoded separately.
+type maddnessJSON[F Float] struct {
+	*maddnessFields[F]
+	Encoders []json.RawMessage `json:"encoders"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+//
+// The decoded model is checked with Validate.
+func (m *Maddness[F]) UnmarshalJSON(b []byte) error {
+	v := maddnessJSON[F]{maddnessFields: (*maddnessFields[F])(m)}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	m.Encoders = make([]Encoder[F], len(v.Encoders))
+	for i, raw := range v.Encoders {
+		e := newEncoder[F](m.Encoding)
+		if e == nil {
+			return fmt.Errorf("maddness: invalid encoding value %d", uint8(m.Encoding))
+		}
+		if err := json.Unmarshal(raw, e); err != nil {
+			return err
+		}
+		m.Encoders[i] = e
+	}
+	return m.Validate()
+}
+
+// lookupTableJSON is the JSON representation of a LookupTable.
+type lookupTableJSON[F Float] struct {
+	Metric    Metric    `json:"metric"`
+	Precision Precision `json:"precision"`
+	Bias      F         `json:"bias"`
+	Scale     F         `json:"scale"`
+	Offsets   Vector[F] `json:"offsets,omitempty"`
+	MaxError  F         `json:"max_error"`
+	QueryNorm F         `json:"query_norm"`
+	Data      []float64 `json:"data"`
+}
+
+// MarshalJSON implements json.Marshaler.
+func (lut *LookupTable[F]) MarshalJSON() ([]byte, error) {
+	size := lut.Precision.Size()
+	if len(lut.Data)%size != 0 {
+		return nil, errors.New("maddness: invalid size of lookup-table data")
+	}
+	data := make([]float64, len(lut.Data)/size)
+	for i := range data {
+		data[i] = lut.Precision.get(lut.Data[i*size:])
+	}
+	return json.Marshal(lookupTableJSON[F]{
+		Metric:    lut.Metric,
+		Precision: lut.Precision,
+		Bias:      lut.Bias,
+		Scale:     lut.Scale,
+		Offsets:   lut.Offsets,
+		MaxError:  lut.MaxError,
+		QueryNorm: lut.QueryNorm,
+		Data:      data,
+	})
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (lut *LookupTable[F]) UnmarshalJSON(b []byte) error {
+	var v lookupTableJSON[F]
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	size := v.Precision.Size()
+	data := make([]uint8, len(v.Data)*size)
+	for i, x := range v.Data {
+		v.Precision.put(data[i*size:], x)
+	}
+	*lut = LookupTable[F]{
+		Bias:      v.Bias,
+		Scale:     v.Scale,
+		Offsets:   v.Offsets,
+		MaxError:  v.MaxError,
+		QueryNorm: v.QueryNorm,
+		Precision: v.Precision,
+		Metric:    v.Metric,
+		Data:      data,
+	}
+	return nil
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (a Aggregation) MarshalText() ([]byte, error) {
+	return marshalName(a, "aggregation")
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (a *Aggregation) UnmarshalText(text []byte) error {
+	return unmarshalName(a, text, "aggregation")
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (s Scaling) MarshalText() ([]byte, error) {
+	return marshalName(s, "scaling")
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (s *Scaling) UnmarshalText(text []byte) error {
+	return unmarshalName(s, text, "scaling")
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (p Precision) MarshalText() ([]byte, error) {
+	return marshalName(p, "precision")
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (p *Precision) UnmarshalText(text []byte) error {
+	return unmarshalName(p, text, "precision")
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (r Rounding) MarshalText() ([]byte, error) {
+	return marshalName(r, "rounding")
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (r *Rounding) UnmarshalText(text []byte) error {
+	return unmarshalName(r, text, "rounding")
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (p Partitioning) MarshalText() ([]byte, error) {
+	return marshalName(p, "partitioning")
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (p *Partitioning) UnmarshalText(text []byte) error {
+	return unmarshalName(p, text, "partitioning")
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (e Encoding) MarshalText() ([]byte, error) {
+	return marshalName(e, "encoding")
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (e *Encoding) UnmarshalText(text []byte) error {
+	return unmarshalName(e, text, "encoding")
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (a Assignment) MarshalText() ([]byte, error) {
+	return marshalName(a, "assignment")
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (a *Assignment) UnmarshalText(text []byte) error {
+	return unmarshalName(a, text, "assignment")
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (m Metric) MarshalText() ([]byte, error) {
+	return marshalName(m, "metric")
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (m *Metric) UnmarshalText(text []byte) error {
+	return unmarshalName(m, text, "metric")
+}
+
+// namedEnum is a setting whose values have a human-readable name.
+type namedEnum interface {
+	~uint8
+	String() string
+}
+
+// unknownName is the name of unrecognized enum values.
+const unknownName = "unknown"
+
+func marshalName[E namedEnum](e E, kind string) ([]byte, error) {
+	name := e.String()
+	if name == unknownName {
+		return nil, fmt.Errorf("maddness: invalid %s value %d", kind, uint8(e))
+	}
+	return []byte(name), nil
+}
+
+func unmarshalName[E namedEnum](e *E, text []byte, kind string) error {
+	name := string(text)
+	for i := 0; i <= 255 && name != unknownName; i++ {
+		if v := E(i); v.String() == name {
+			*e = v
+			return nil
+		}
+	}
+	return fmt.Errorf("maddness: unknown %s %q", kind, name)
+}
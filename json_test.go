@@ -0,0 +1,176 @@
+// Copyright 2022, NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gomaddness
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMaddness_JSON(t *testing.T) {
+	t.Run("float32", testMaddnessJSON[float32])
+	t.Run("float64", testMaddnessJSON[float64])
+}
+
+func testMaddnessJSON[F Float](t *testing.T) {
+	examples, queryVectors := randomExamples[F](128, 16, 3)
+
+	for _, opts := range [][]Option{
+		nil,
+		{WithScaling(ScalingPerSubspace), WithAggregation(AggregationAveraging)},
+		{WithPrecision(PrecisionUint16), WithRounding(RoundingStochastic)},
+		{WithPrecision(PrecisionFloat16)},
+		{WithPrecision(PrecisionFloat32)},
+		{WithPartitioning(PartitioningVarianceBalanced)},
+		{WithEncoding(EncodingPQ), WithNumCodes(32), WithPartitioning(PartitioningCorrelated)},
+		{WithRotation(1)},
+		{WithEncoding(EncodingUnbalancedTree), WithScaling(ScalingPerSubspace)},
+		{WithAssignment(AssignmentNearestPrototype)},
+		{WithMetric(MetricSquaredL2), WithPrecision(PrecisionUint16)},
+	} {
+		m := TrainMaddness(examples, queryVectors, 4, opts...)
+
+		data, err := json.Marshal(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var m2 *Maddness[F]
+		if err := json.Unmarshal(data, &m2); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(m, m2) {
+			t.Errorf("expected %+v, actual %+v", m, m2)
+		}
+	}
+
+	t.Run("uneven subspaces", func(t *testing.T) {
+		m := TrainMaddness(examples, queryVectors, 3)
+		data, err := json.Marshal(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var m2 *Maddness[F]
+		if err := json.Unmarshal(data, &m2); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(m, m2) {
+			t.Errorf("expected %+v, actual %+v", m, m2)
+		}
+	})
+
+	t.Run("schema", func(t *testing.T) {
+		lut := &LookupTable[F]{
+			Bias:      1,
+			Scale:     2,
+			MaxError:  0.5,
+			QueryNorm: 3,
+			Precision: PrecisionUint16,
+			Data:      []uint8{1, 0, 0, 1},
+		}
+		data, err := json.Marshal(lut)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := `{"metric":"dot-product","precision":"uint16","bias":1,"scale":2,"max_error":0.5,"query_norm":3,"data":[1,256]}`
+		if string(data) != expected {
+			t.Errorf("expected %s, actual %s", expected, data)
+		}
+	})
+
+	t.Run("inconsistent structure", func(t *testing.T) {
+		for name, modify := range map[string]func(m *Maddness[F]){
+			"prototypes": func(m *Maddness[F]) {
+				h := m.Encoders[1].(*Hash[F])
+				h.Codebook = h.Codebook[1:]
+			},
+			"thresholds": func(m *Maddness[F]) {
+				level := m.Encoders[0].(*Hash[F]).TreeLevels[2]
+				level.SplitThresholds = level.SplitThresholds[1:]
+			},
+			"lookup table": func(m *Maddness[F]) {
+				m.LookupTables[2].Data = m.LookupTables[2].Data[1:]
+			},
+		} {
+			m := TrainMaddness(examples, queryVectors, 4)
+			modify(m)
+			data, err := json.Marshal(m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var m2 *Maddness[F]
+			if err := json.Unmarshal(data, &m2); err == nil {
+				t.Errorf("%s: expected error", name)
+			}
+		}
+	})
+
+	t.Run("invalid names", func(t *testing.T) {
+		for _, s := range []string{
+			`{"aggregation":"fastest"}`,
+			`{"scaling":"unknown"}`,
+			`{"lookup_tables":[{"precision":"int4"}]}`,
+		} {
+			var m *Maddness[F]
+			if err := json.Unmarshal([]byte(s), &m); err == nil {
+				t.Errorf("expected error unmarshalling %s", s)
+			}
+		}
+		if _, err := json.Marshal(&Maddness[F]{Rounding: 42}); err == nil {
+			t.Error("expected error marshalling an invalid rounding")
+		}
+	})
+}
+
+func TestMaddness_Dump(t *testing.T) {
+	t.Run("float32", testMaddnessDump[float32])
+	t.Run("float64", testMaddnessDump[float64])
+}
+
+func testMaddnessDump[F Float](t *testing.T) {
+	m := &Maddness[F]{
+		NumSubspaces:  2,
+		VectorSize:    4,
+		SubVectorSize: 2,
+		Encoders: []Encoder[F]{
+			&Hash[F]{
+				TreeLevels: []*HashingTreeLevel[F]{{SplitIndex: 1, SplitThresholds: Vector[F]{0.5}}},
+				Codebook:   Vectors[F]{{0, 0}, {3, 4}},
+			},
+			&Hash[F]{
+				TreeLevels: []*HashingTreeLevel[F]{{SplitIndex: 0, SplitThresholds: Vector[F]{-2}}},
+				Codebook:   Vectors[F]{{-3, 0}, {1, 0}},
+			},
+		},
+		LookupTables: []*LookupTable[F]{
+			{Bias: -1, Scale: 4, MaxError: 0.25, QueryNorm: 2, Data: make([]uint8, 4)},
+		},
+		RandomSeed: 1,
+	}
+
+	var sb strings.Builder
+	if err := m.Dump(&sb); err != nil {
+		t.Fatal(err)
+	}
+	expected := `maddness: 2 subspaces, vector size 4, sub-vector size 2
+aggregation exact, scaling global, precision uint8, rounding nearest, random seed 1
+subspace 0, columns [0, 2):
+  x[1] < 0.5:
+    prototype 0, norm 0
+  x[1] >= 0.5:
+    prototype 1, norm 5
+subspace 1, columns [2, 4):
+  x[2] < -2:
+    prototype 0, norm 3
+  x[2] >= -2:
+    prototype 1, norm 1
+lookup tables: 1
+  0: precision uint8, bias -1, scale 4, max error 0.25, query norm 2
+`
+	if actual := sb.String(); actual != expected {
+		t.Errorf("expected:\n%s\nactual:\n%s", expected, actual)
+	}
+}
@@ -4,13 +4,360 @@
 
 package gomaddness
 
-// LookupTable holds a table of pre-computed dot products, quantized to 8 bits,
-// and the parameters needed for de-quantization during the product
-// quantization's aggregation step.
+import (
+	"encoding/binary"
+	"math"
+	"math/rand"
+
+	"github.com/nlpodyssey/gomaddness/internal/float16"
+)
+
+// MaxLookupTableSize is the maximum number of entries of a LookupTable,
+// that is, the number of subspaces times the number of codes of each
+// subspace, so that all entries can be addressed by uint16 lookup-table
+// indices (see Maddness.LookupTableIndices).
+const MaxLookupTableSize = 1 << 16
+
+// LookupTable holds a table of pre-computed dot products (or squared
+// distances, according to its Metric), stored with the table's Precision
+// (quantized to 8 bits, by default), and the parameters needed for
+// de-quantization during the product quantization's aggregation step.
 type LookupTable[F Float] struct {
 	Bias  F
 	Scale F
+	// Offsets, only present with ScalingPerSubspace, are the values
+	// subtracted from each row before quantization. Their sum is Bias.
+	Offsets Vector[F]
+	// MaxError is the maximum absolute difference between a pre-computed
+	// dot product and its de-quantized (or converted) value.
+	MaxError F
+	// QueryNorm is the Euclidean norm of the query vector, used for
+	// approximating cosine similarities (see Maddness.CosineSimilarity).
+	// It is zero for models saved before it was introduced.
+	QueryNorm F
+	// Precision of the elements of Data.
+	Precision Precision
+	// Metric of the pre-computed values.
+	Metric Metric
 	// Matrix, represented in row-major order, with row index = subspace,
 	// and column index = prototype.
+	//
+	// Each element occupies Precision.Size() bytes, in little-endian order.
 	Data []uint8
 }
+
+// Scaling identifies the strategy used for quantizing the pre-computed
+// dot products of a LookupTable.
+type Scaling uint8
+
+const (
+	// ScalingGlobal quantizes all the values of a LookupTable with a single
+	// offset and scale, computed over all subspaces.
+	ScalingGlobal Scaling = iota
+	// ScalingPerSubspace subtracts from each row (subspace) of a LookupTable
+	// its own minimum value, and quantizes all rows with a shared scale,
+	// rounded down to a power of two. This way, a subspace with a large
+	// dynamic range does not crush the precision of all the others.
+	ScalingPerSubspace
+)
+
+// String returns a human-readable name of the scaling strategy.
+func (s Scaling) String() string {
+	switch s {
+	case ScalingGlobal:
+		return "global"
+	case ScalingPerSubspace:
+		return "per-subspace"
+	default:
+		return "unknown"
+	}
+}
+
+// Rounding identifies the strategy used for rounding values to integers
+// while quantizing a LookupTable.
+type Rounding uint8
+
+const (
+	// RoundingNearest rounds each value to the nearest integer.
+	RoundingNearest Rounding = iota
+	// RoundingStochastic rounds each value up or down at random, with
+	// a probability proportional to its distance from the other integer,
+	// so that the rounding is unbiased in expectation.
+	RoundingStochastic
+)
+
+// String returns a human-readable name of the rounding strategy.
+func (r Rounding) String() string {
+	switch r {
+	case RoundingNearest:
+		return "nearest"
+	case RoundingStochastic:
+		return "stochastic"
+	default:
+		return "unknown"
+	}
+}
+
+// Precision identifies the type of the elements of a LookupTable.
+type Precision uint8
+
+const (
+	// PrecisionUint8 quantizes the pre-computed dot products to 8-bit
+	// unsigned integers.
+	PrecisionUint8 Precision = iota
+	// PrecisionUint16 quantizes the pre-computed dot products to 16-bit
+	// unsigned integers.
+	PrecisionUint16
+	// PrecisionFloat16 stores the pre-computed dot products as IEEE 754
+	// half-precision floating point values, without quantization.
+	PrecisionFloat16
+	// PrecisionFloat32 stores the pre-computed dot products as IEEE 754
+	// single-precision floating point values, without quantization.
+	PrecisionFloat32
+)
+
+// String returns a human-readable name of the precision.
+func (p Precision) String() string {
+	switch p {
+	case PrecisionUint8:
+		return "uint8"
+	case PrecisionUint16:
+		return "uint16"
+	case PrecisionFloat16:
+		return "float16"
+	case PrecisionFloat32:
+		return "float32"
+	default:
+		return "unknown"
+	}
+}
+
+// Size returns the size in bytes of an element with precision p.
+func (p Precision) Size() int {
+	switch p {
+	case PrecisionUint16, PrecisionFloat16:
+		return 2
+	case PrecisionFloat32:
+		return 4
+	default:
+		return 1
+	}
+}
+
+// IsQuantized reports whether the values are quantized to integers,
+// requiring Bias and Scale for de-quantization.
+func (p Precision) IsQuantized() bool {
+	return p == PrecisionUint8 || p == PrecisionUint16
+}
+
+// maxQuantizedValue returns the maximum integer value for a quantized
+// precision.
+func (p Precision) maxQuantizedValue() float64 {
+	if p == PrecisionUint16 {
+		return math.MaxUint16
+	}
+	return math.MaxUint8
+}
+
+// put stores x into b, according to the precision.
+//
+// Quantized precisions expect x to be already rounded, and clamp it
+// to the range of valid integers.
+func (p Precision) put(b []uint8, x float64) {
+	if p.IsQuantized() {
+		x = math.Max(0, math.Min(x, p.maxQuantizedValue()))
+	}
+	switch p {
+	case PrecisionUint16:
+		binary.LittleEndian.PutUint16(b, uint16(x))
+	case PrecisionFloat16:
+		binary.LittleEndian.PutUint16(b, float16.FromFloat32(float32(x)))
+	case PrecisionFloat32:
+		binary.LittleEndian.PutUint32(b, math.Float32bits(float32(x)))
+	default:
+		b[0] = uint8(x)
+	}
+}
+
+// get reads a value from b, according to the precision.
+func (p Precision) get(b []uint8) float64 {
+	switch p {
+	case PrecisionUint16:
+		return float64(binary.LittleEndian.Uint16(b))
+	case PrecisionFloat16:
+		return float64(float16.ToFloat32(binary.LittleEndian.Uint16(b)))
+	case PrecisionFloat32:
+		return float64(math.Float32frombits(binary.LittleEndian.Uint32(b)))
+	default:
+		return float64(b[0])
+	}
+}
+
+// sum returns the sum of the table elements at the given indices,
+// aggregated with a, before de-quantization.
+//
+// Aggregation a is only meaningful for PrecisionUint8, while the elements
+// of any other precision are always summed exactly.
+func (lut *LookupTable[F]) sum(indices []uint16, a Aggregation) F {
+	if sum, ok := lut.integerSum(indices, a); ok {
+		return F(sum)
+	}
+	data := lut.Data
+	switch lut.Precision {
+	case PrecisionFloat16:
+		var sum float32
+		for _, i := range indices {
+			sum += float16.ToFloat32(binary.LittleEndian.Uint16(data[int(i)*2:]))
+		}
+		return F(sum)
+	case PrecisionFloat32:
+		var sum float32
+		for _, i := range indices {
+			sum += math.Float32frombits(binary.LittleEndian.Uint32(data[int(i)*4:]))
+		}
+		return F(sum)
+	default:
+		return averagingSum[F](data, indices)
+	}
+}
+
+// integerSum returns the exact integer sum of the table elements at the
+// given indices, before de-quantization.
+//
+// It reports false, without summing, if the table has a floating point
+// precision, or if a is AggregationAveraging with PrecisionUint8.
+func (lut *LookupTable[F]) integerSum(indices []uint16, a Aggregation) (uint64, bool) {
+	data := lut.Data
+	switch lut.Precision {
+	case PrecisionUint8:
+		if a == AggregationAveraging {
+			return 0, false
+		}
+		return uint64(exactSum(data, indices)), true
+	case PrecisionUint16:
+		var sum uint64
+		for _, i := range indices {
+			sum += uint64(binary.LittleEndian.Uint16(data[int(i)*2:]))
+		}
+		return sum, true
+	default:
+		return 0, false
+	}
+}
+
+// mayExceed reports whether the integer sum, returned by integerSum,
+// may be de-quantized to a value greater than x.
+//
+// The comparison happens in the integer domain of the table, against x
+// transformed with Bias and Scale, with a small relative margin covering
+// the rounding errors of the de-quantization: a false result is exact,
+// while a true one must be confirmed with the de-quantized sum.
+func (lut *LookupTable[F]) mayExceed(sum uint64, x F) bool {
+	if lut.Scale <= 0 {
+		return true
+	}
+	scale := float64(lut.Scale)
+	threshold := (float64(x) - float64(lut.Bias)) * scale
+	margin := 1e-6 * (float64(sum) + math.Abs(threshold) + math.Abs(float64(lut.Bias))*scale)
+	return float64(sum)+margin > threshold
+}
+
+// newLookupTable creates a new LookupTable from the given pre-computed
+// dot products, according to scaling and precision.
+//
+// Quantized values are rounded to the nearest integer, or stochastically
+// if rng is not nil.
+// Unquantized precisions ignore the scaling, storing the values as they are.
+func newLookupTable[F Float](floatData Vectors[F], scaling Scaling, precision Precision, rng *rand.Rand) *LookupTable[F] {
+	lut := &LookupTable[F]{
+		Scale:     1,
+		Precision: precision,
+	}
+
+	offsets := make(Vector[F], len(floatData))
+	if precision.IsQuantized() {
+		switch scaling {
+		case ScalingPerSubspace:
+			lut.Bias, lut.Scale = perSubspaceScaling(floatData, offsets, precision)
+			lut.Offsets = offsets
+		default:
+			lut.Bias, lut.Scale = globalScaling(floatData, offsets, precision)
+		}
+	}
+
+	size := precision.Size()
+	lut.Data = make([]uint8, len(floatData)*len(floatData[0])*size)
+	pos := 0
+	for i, row := range floatData {
+		offset := offsets[i]
+		for _, v := range row {
+			x := float64((v - offset) * lut.Scale)
+			if precision.IsQuantized() {
+				x = round(x, rng)
+			}
+			b := lut.Data[pos:]
+			precision.put(b, x)
+			pos += size
+
+			dequantized := F(precision.get(b))/lut.Scale + offset
+			if e := F(math.Abs(float64(dequantized - v))); e > lut.MaxError {
+				lut.MaxError = e
+			}
+		}
+	}
+	return lut
+}
+
+// round rounds x to the nearest integer, or stochastically if rng
+// is not nil.
+func round(x float64, rng *rand.Rand) float64 {
+	if rng == nil {
+		return math.Round(x)
+	}
+	return math.Floor(x + rng.Float64())
+}
+
+// globalScaling computes the parameters for quantizing floatData according
+// to ScalingGlobal, setting the offset of each row.
+func globalScaling[F Float](floatData Vectors[F], offsets Vector[F], precision Precision) (bias, scale F) {
+	min, max := F(math.Inf(1)), F(math.Inf(-1))
+	for _, row := range floatData {
+		rowMin, rowMax := row.MinMax()
+		if rowMin < min {
+			min = rowMin
+		}
+		if rowMax > max {
+			max = rowMax
+		}
+	}
+	for i := range offsets {
+		offsets[i] = min
+	}
+
+	bias = min * F(len(floatData))
+	scale = 1 // any scale is fine with zero dynamic range
+	if max > min {
+		scale = F(precision.maxQuantizedValue()) / (max - min)
+	}
+	return
+}
+
+// perSubspaceScaling computes the parameters for quantizing floatData
+// according to ScalingPerSubspace, setting the offset of each row.
+func perSubspaceScaling[F Float](floatData Vectors[F], offsets Vector[F], precision Precision) (bias, scale F) {
+	var maxRange F
+	for i, row := range floatData {
+		rowMin, rowMax := row.MinMax()
+		offsets[i] = rowMin
+		bias += rowMin
+		if r := rowMax - rowMin; r > maxRange {
+			maxRange = r
+		}
+	}
+
+	scale = 1 // any scale is fine with zero dynamic range
+	if maxRange > 0 {
+		scale = F(math.Exp2(math.Floor(math.Log2(precision.maxQuantizedValue() / float64(maxRange)))))
+	}
+	return
+}
@@ -0,0 +1,274 @@
+// Copyright 2022, NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gomaddness
+
+import (
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestScaling(t *testing.T) {
+	t.Run("float32", testScaling[float32])
+	t.Run("float64", testScaling[float64])
+}
+
+func testScaling[F Float](t *testing.T) {
+	// The first subspace has a much larger dynamic range than the others.
+	floatData := Vectors[F]{
+		{-1000, -300, 200, 1000},
+		{0.1, 0.2, 0.3, 0.4},
+		{1.5, 1.25, 1.75, 1},
+		{-2, -1, 0, 1},
+	}
+
+	global := newLookupTable(floatData, ScalingGlobal, PrecisionUint8, nil)
+	perSubspace := newLookupTable(floatData, ScalingPerSubspace, PrecisionUint8, nil)
+
+	if len(perSubspace.Offsets) != len(floatData) {
+		t.Fatalf("expected %d offsets, actual %d", len(floatData), len(perSubspace.Offsets))
+	}
+	var sumOfOffsets F
+	for _, o := range perSubspace.Offsets {
+		sumOfOffsets += o
+	}
+	if sumOfOffsets != perSubspace.Bias {
+		t.Errorf("expected bias %v to be the sum of offsets %v", perSubspace.Bias, sumOfOffsets)
+	}
+	if s := math.Log2(float64(perSubspace.Scale)); s != math.Trunc(s) {
+		t.Errorf("expected a power-of-two scale, actual %v", perSubspace.Scale)
+	}
+
+	var globalErr, perSubspaceErr float64
+	cols := len(floatData[0])
+	for i, row := range floatData {
+		var globalRowErr, perSubspaceRowErr float64
+		for j, v := range row {
+			g := F(global.Data[i*cols+j])/global.Scale + global.Bias/F(len(floatData))
+			p := F(perSubspace.Data[i*cols+j])/perSubspace.Scale + perSubspace.Offsets[i]
+			globalRowErr += math.Abs(float64(g - v))
+			perSubspaceRowErr += math.Abs(float64(p - v))
+		}
+		t.Logf("subspace %d: global error %.4f, per-subspace error %.4f", i, globalRowErr, perSubspaceRowErr)
+		globalErr += globalRowErr
+		perSubspaceErr += perSubspaceRowErr
+	}
+	t.Logf("total: global error %.4f, per-subspace error %.4f", globalErr, perSubspaceErr)
+
+	if perSubspaceErr >= globalErr {
+		t.Errorf("expected per-subspace error %v to be lower than global error %v", perSubspaceErr, globalErr)
+	}
+}
+
+func TestTrainMaddness_WithScaling(t *testing.T) {
+	t.Run("float32", testTrainMaddnessWithScaling[float32])
+	t.Run("float64", testTrainMaddnessWithScaling[float64])
+}
+
+func testTrainMaddnessWithScaling[F Float](t *testing.T) {
+	examples := Vectors[F]{
+		{1, 2, 30, 10}, {2, 4, 40, 20}, {3, 6, 60, 30}, {4, 8, 90, 40},
+		{5, 10, 130, 100}, {6, 12, 180, 110}, {7, 14, 240, 120}, {8, 16, 310, 130},
+	}
+	queryVectors := Vectors[F]{{1, 2, 3, 4}}
+
+	m := TrainMaddness(examples, queryVectors, 2, WithScaling(ScalingPerSubspace))
+	if m.Scaling != ScalingPerSubspace {
+		t.Fatalf("expected scaling %v, actual %v", ScalingPerSubspace, m.Scaling)
+	}
+	if len(m.LookupTables[0].Offsets) != 2 {
+		t.Fatalf("expected 2 offsets, actual %v", m.LookupTables[0].Offsets)
+	}
+	for _, ex := range examples {
+		lutIndices := m.LookupTableIndices(m.Quantize(ex))
+		t.Logf("%v\texact %v\tapprox %v", ex, ex.DotProduct(queryVectors[0]), m.DotProduct(lutIndices, 0))
+	}
+}
+
+func TestPrecision(t *testing.T) {
+	t.Run("float32", testPrecision[float32])
+	t.Run("float64", testPrecision[float64])
+}
+
+func testPrecision[F Float](t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	examples := make(Vectors[F], 256)
+	for i := range examples {
+		examples[i] = make(Vector[F], 16)
+		for j := range examples[i] {
+			examples[i][j] = F(r.NormFloat64())
+		}
+	}
+	queryVectors := examples[:4]
+
+	precisions := []Precision{PrecisionUint8, PrecisionUint16, PrecisionFloat16, PrecisionFloat32}
+	errors := make(map[Precision]float64, len(precisions))
+
+	for _, p := range precisions {
+		m := TrainMaddness(examples, queryVectors, 4, WithPrecision(p))
+		lut := m.LookupTables[0]
+		if lut.Precision != p {
+			t.Fatalf("expected precision %v, actual %v", p, lut.Precision)
+		}
+		if expected := 4 * 16 * p.Size(); len(lut.Data) != expected {
+			t.Fatalf("%v: expected %d bytes of data, actual %d", p, expected, len(lut.Data))
+		}
+
+		// Compare against the dot products with the reconstructed vectors,
+		// so that only the lookup-table error is measured.
+		var sumErr float64
+		for _, ex := range examples {
+			q := m.Quantize(ex)
+			lutIndices := m.LookupTableIndices(q)
+			rec := m.Reconstruct(q)
+			for qi, qv := range queryVectors {
+				sumErr += math.Abs(float64(m.DotProduct(lutIndices, qi) - rec.DotProduct(qv)))
+			}
+		}
+		errors[p] = sumErr / float64(len(examples)*len(queryVectors))
+		t.Logf("%v: mean absolute error %g", p, errors[p])
+	}
+
+	if errors[PrecisionUint16] >= errors[PrecisionUint8] {
+		t.Errorf("expected uint16 error to be lower than uint8 error")
+	}
+	if errors[PrecisionFloat32] >= errors[PrecisionUint8] {
+		t.Errorf("expected float32 error to be lower than uint8 error")
+	}
+	if errors[PrecisionFloat16] >= errors[PrecisionUint8] {
+		t.Errorf("expected float16 error to be lower than uint8 error")
+	}
+}
+
+func TestNewLookupTable_Rounding(t *testing.T) {
+	t.Run("float32", testNewLookupTableRounding[float32])
+	t.Run("float64", testNewLookupTableRounding[float64])
+}
+
+func testNewLookupTableRounding[F Float](t *testing.T) {
+	t.Run("zero dynamic range", func(t *testing.T) {
+		floatData := Vectors[F]{{3, 3, 3}, {3, 3, 3}}
+		for _, s := range []Scaling{ScalingGlobal, ScalingPerSubspace} {
+			for _, p := range []Precision{PrecisionUint8, PrecisionUint16} {
+				lut := newLookupTable(floatData, s, p, nil)
+				if lut.Bias != 6 || lut.MaxError != 0 {
+					t.Errorf("%v %v: expected bias 6 and no error, actual %v and %v", s, p, lut.Bias, lut.MaxError)
+				}
+				if sum := lut.sum([]uint16{0, 5}, AggregationExact)/lut.Scale + lut.Bias; sum != 6 {
+					t.Errorf("%v %v: expected 6, actual %v", s, p, sum)
+				}
+			}
+		}
+	})
+
+	t.Run("round to nearest", func(t *testing.T) {
+		floatData := Vectors[F]{{0, 0.7, 1.3, 255}}
+		lut := newLookupTable(floatData, ScalingGlobal, PrecisionUint8, nil)
+		expected := []uint8{0, 1, 1, 255}
+		if !reflect.DeepEqual(expected, lut.Data) {
+			t.Errorf("expected %v, actual %v", expected, lut.Data)
+		}
+		if lut.MaxError < 0.29 || lut.MaxError > 0.31 {
+			t.Errorf("expected max error 0.3, actual %v", lut.MaxError)
+		}
+	})
+
+	t.Run("max error is bounded", func(t *testing.T) {
+		r := rand.New(rand.NewSource(1))
+		floatData := make(Vectors[F], 8)
+		for i := range floatData {
+			floatData[i] = make(Vector[F], 16)
+			for j := range floatData[i] {
+				floatData[i][j] = F(r.NormFloat64() * 10)
+			}
+		}
+		for _, s := range []Scaling{ScalingGlobal, ScalingPerSubspace} {
+			lut := newLookupTable(floatData, s, PrecisionUint8, nil)
+			bound := 0.5/lut.Scale + 1e-4
+			t.Logf("%v: max error %v, bound %v", s, lut.MaxError, bound)
+			if lut.MaxError > bound {
+				t.Errorf("%v: max error %v exceeds %v", s, lut.MaxError, bound)
+			}
+		}
+	})
+
+	t.Run("stochastic rounding is unbiased", func(t *testing.T) {
+		floatData := Vectors[F]{{0, 0.25, 0.5, 0.75, 255}}
+		sums := make([]float64, 5)
+		const trials = 4000
+		r := rand.New(rand.NewSource(1))
+		for i := 0; i < trials; i++ {
+			lut := newLookupTable(floatData, ScalingGlobal, PrecisionUint8, r)
+			for j, v := range lut.Data {
+				sums[j] += float64(v)
+			}
+		}
+		for j, v := range floatData[0] {
+			mean := sums[j] / trials
+			if math.Abs(mean-float64(v)) > 0.03 {
+				t.Errorf("value %v: expected mean %v, actual %v", v, v, mean)
+			}
+		}
+	})
+}
+
+func TestTrainMaddness_ConstantQuery(t *testing.T) {
+	t.Run("float32", testTrainMaddnessConstantQuery[float32])
+	t.Run("float64", testTrainMaddnessConstantQuery[float64])
+}
+
+func testTrainMaddnessConstantQuery[F Float](t *testing.T) {
+	examples := Vectors[F]{
+		{1, 2, 3, 1}, {2, 4, 4, 2}, {3, 6, 6, 3}, {4, 8, 9, 4},
+		{5, 10, 13, 10}, {6, 12, 18, 11}, {7, 14, 24, 12}, {8, 16, 31, 13},
+	}
+	// All the dot products with a zero query are equal (zero dynamic range),
+	// and must be reconstructed exactly.
+	queryVectors := Vectors[F]{{0, 0, 0, 0}}
+
+	for _, s := range []Scaling{ScalingGlobal, ScalingPerSubspace} {
+		m := TrainMaddness(examples, queryVectors, 2, WithScaling(s))
+		lut := m.LookupTables[0]
+		if lut.MaxError != 0 {
+			t.Errorf("%v: expected no error, actual %v", s, lut.MaxError)
+		}
+		for _, ex := range examples {
+			if dp := m.DotProduct(m.LookupTableIndices(m.Quantize(ex)), 0); dp != 0 {
+				t.Errorf("%v: expected exactly 0, actual %v", s, dp)
+			}
+		}
+	}
+}
+
+func TestLookupTable_mayExceed(t *testing.T) {
+	t.Run("float32", testLookupTableMayExceed[float32])
+	t.Run("float64", testLookupTableMayExceed[float64])
+}
+
+func testLookupTableMayExceed[F Float](t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for trial := 0; trial < 1000; trial++ {
+		lut := &LookupTable[F]{
+			Bias:  F(r.NormFloat64() * 100),
+			Scale: F(math.Exp(r.NormFloat64() * 5)),
+		}
+		sum := uint64(r.Intn(1 << 20))
+		dequantized := F(sum)/lut.Scale + lut.Bias
+
+		// A value just below the de-quantized sum must never be excluded.
+		x := F(math.Nextafter(float64(dequantized), math.Inf(-1)))
+		if x == dequantized {
+			x = F(math.Nextafter32(float32(dequantized), float32(math.Inf(-1))))
+		}
+		if !lut.mayExceed(sum, x) {
+			t.Fatalf("sum %d (%v) with bias %v and scale %v: expected to exceed %v", sum, dequantized, lut.Bias, lut.Scale, x)
+		}
+		// A value well above it must always be excluded.
+		if x := dequantized + 2/lut.Scale + F(math.Abs(float64(dequantized)))*1e-3; lut.mayExceed(sum, x) {
+			t.Errorf("sum %d (%v) with bias %v and scale %v: expected not to exceed %v", sum, dequantized, lut.Bias, lut.Scale, x)
+		}
+	}
+}
@@ -5,65 +5,142 @@
 package gomaddness
 
 import (
+	"fmt"
 	"log"
 	"math"
+	"math/rand"
 	"runtime"
 )
 
 // Maddness is the primary structure that holds parameters and implements
 // methods of the whole MADDNESS algorithm.
 type Maddness[F Float] struct {
-	NumSubspaces  int
-	VectorSize    int
-	SubVectorSize int
-	Hashes        []*Hash[F]
-	LookupTables  []*LookupTable[F]
+	NumSubspaces  int `json:"num_subspaces"`
+	VectorSize    int `json:"vector_size"`
+	SubVectorSize int `json:"sub_vector_size"`
+	// SubspaceOffsets, only present when the subspaces have different
+	// sizes, are the boundaries of the subspaces: the i-th subspace covers
+	// the vector elements in [SubspaceOffsets[i], SubspaceOffsets[i+1]).
+	// In that case, SubVectorSize is the size of the largest subspace.
+	SubspaceOffsets []int `json:"subspace_offsets,omitempty"`
+	// Permutation, only present when the partitioning is not contiguous,
+	// is the order in which the elements of the vectors are assigned to
+	// the subspaces: the j-th element of the permuted vector, as split into
+	// subspaces, is the Permutation[j]-th element of the original vector.
+	Permutation []int `json:"permutation,omitempty"`
+	// Rotation, only present if learned (see WithRotation), is an
+	// orthogonal matrix of size VectorSize x VectorSize, by which the
+	// vectors are multiplied before being split into subspaces (and before
+	// Permutation is applied). Query vectors are rotated in the same way
+	// when building the lookup tables, preserving the dot products.
+	Rotation Vectors[F] `json:"rotation,omitempty"`
+	// Encoders hold the Encoder of each subspace, whose type depends on
+	// Encoding. All encoders have the same number of codes.
+	Encoders []Encoder[F] `json:"encoders"`
+	// PrototypeSquaredNorms are the squared Euclidean norms of the
+	// prototypes of all encoders, in the same order as the entries of a
+	// lookup table, used by QuantizedNorm. Models saved before their
+	// introduction do not have them.
+	PrototypeSquaredNorms Vector[F]         `json:"prototype_squared_norms,omitempty"`
+	LookupTables          []*LookupTable[F] `json:"lookup_tables"`
+	// Aggregation is the strategy used by DotProduct for aggregating
+	// the lookup-table entries. By default, they are summed exactly.
+	Aggregation Aggregation `json:"aggregation"`
+	// Scaling is the strategy used for quantizing the lookup tables.
+	Scaling Scaling `json:"scaling"`
+	// Precision of the elements of the lookup tables.
+	Precision Precision `json:"precision"`
+	// Rounding is the strategy used for rounding the values of quantized
+	// lookup tables.
+	Rounding Rounding `json:"rounding"`
+	// RandomSeed is the seed for the pseudo-random number generators used
+	// by the training process and by RoundingStochastic.
+	RandomSeed int64 `json:"random_seed"`
+	// Partitioning is the strategy used for assigning the elements of the
+	// vectors to subspaces, resulting in Permutation.
+	Partitioning Partitioning `json:"partitioning"`
+	// Encoding is the kind of the Encoders.
+	Encoding Encoding `json:"encoding"`
+	// Assignment is the strategy used by Quantize for assigning the
+	// sub-vectors to prototypes. Since the lookup tables do not depend on
+	// it, it can be changed after training.
+	Assignment Assignment `json:"assignment"`
 }
 
 // TrainMaddness runs the learning process for MADDNESS product quantization and
 // hash functions parameters, returning a new trained Maddness object.
-func TrainMaddness[F Float](dataExamples, queryVectors Vectors[F], numSubspaces int) *Maddness[F] {
+//
+// Optional aspects of the training can be configured with opts.
+//
+// If numSubspaces is not a factor of the vectors' length, the subspaces
+// have different sizes, as described by Maddness.SubspaceOffsets.
+//
+// It panics if the arguments are invalid, with the error that would be
+// returned by ValidateTrainingData.
+func TrainMaddness[F Float](dataExamples, queryVectors Vectors[F], numSubspaces int, opts ...Option) *Maddness[F] {
 	log.Printf("maddness: training starts.")
+	o := newOptions(opts)
 
-	if len(dataExamples) == 0 {
-		panic("maddness: invalid empty dataExamples")
+	if err := ValidateTrainingData(dataExamples, queryVectors, numSubspaces, opts...); err != nil {
+		panic(err)
 	}
-	if len(queryVectors) == 0 {
-		panic("maddness: invalid empty queryVectors")
-	}
-
 	vecSize := len(dataExamples[0])
-	if vecSize == 0 {
-		panic("maddness: invalid zero vector size")
-	}
-
-	if numSubspaces < 0 || numSubspaces > vecSize || vecSize%numSubspaces != 0 {
-		panic("maddness: invalid numSubspaces (it must be a positive factor of vectors' length)")
-	}
 
 	m := &Maddness[F]{
-		NumSubspaces:  numSubspaces,
-		VectorSize:    vecSize,
-		SubVectorSize: vecSize / numSubspaces,
+		NumSubspaces:    numSubspaces,
+		VectorSize:      vecSize,
+		SubVectorSize:   (vecSize + numSubspaces - 1) / numSubspaces,
+		SubspaceOffsets: subspaceOffsets(vecSize, numSubspaces),
+		Aggregation:     o.aggregation,
+		Scaling:         o.scaling,
+		Precision:       o.precision,
+		Rounding:        o.rounding,
+		RandomSeed:      o.randomSeed,
+		Partitioning:    o.partitioning,
+		Encoding:        o.encoding,
+		Assignment:      o.assignment,
 	}
 
-	m.trainAllHashes(dataExamples)
-	m.makeLookupTables(queryVectors)
+	m.Permutation = m.learnPermutation(dataExamples)
+	if o.rotationIterations > 0 {
+		m.learnRotation(dataExamples, o.numCodes, o.rotationIterations)
+	}
+	m.trainAllEncoders(m.permuteAll(m.rotateAll(dataExamples)), o.numCodes)
+	m.PrototypeSquaredNorms = m.prototypeSquaredNorms()
+	m.makeLookupTables(queryVectors, o.queryMetrics(len(queryVectors)))
 
 	return m
 }
 
+// TrainMaddnessMatrix is like TrainMaddness, but data examples and query
+// vectors are the rows of the given matrices.
+//
+// The matrices' memory is shared, not copied.
+func TrainMaddnessMatrix[F Float](dataExamples, queryVectors Matrix[F], numSubspaces int, opts ...Option) *Maddness[F] {
+	return TrainMaddness(dataExamples.Vectors(), queryVectors.Vectors(), numSubspaces, opts...)
+}
+
 // Quantize splits the given vector into subspaces and returns a slice
-// of hash indices, one for each subspace.
+// of codes (hash indices), one for each subspace, as assigned by the
+// subspaces' encoders, or to the nearest prototypes, according to
+// m.Assignment.
+//
+// It panics if the size of v differs from m.VectorSize. Values are not
+// checked: see ValidateVector.
 func (m *Maddness[F]) Quantize(v Vector[F]) []uint8 {
-	hashes := m.Hashes
-	subVectorSize := m.SubVectorSize
-
-	q := make([]uint8, len(hashes))
-	for i, hash := range hashes {
-		offset := i * subVectorSize
-		subVector := v[offset : offset+subVectorSize]
-		q[i] = hash.Hash(subVector)
+	if len(v) != m.VectorSize {
+		panic(fmt.Sprintf("maddness: %v %d, expected %d", ErrVectorSize, len(v), m.VectorSize))
+	}
+	v = m.permute(m.rotate(v))
+
+	q := make([]uint8, len(m.Encoders))
+	for i, e := range m.Encoders {
+		begin, end := m.SubspaceBounds(i)
+		if m.Assignment == AssignmentNearestPrototype {
+			q[i] = uint8(nearestPrototype(e.Prototypes(), v[begin:end]))
+		} else {
+			q[i] = e.Encode(v[begin:end])
+		}
 	}
 	return q
 }
@@ -72,7 +149,7 @@ func (m *Maddness[F]) Quantize(v Vector[F]) []uint8 {
 // Quantize, into a corresponding list of lookup-table indices,
 // for accessing LookupTable.Data.
 func (m *Maddness[F]) LookupTableIndices(q []uint8) []uint16 {
-	lutCols := len(m.Hashes[0].Prototypes)
+	lutCols := m.Encoders[0].NumCodes()
 	indices := make([]uint16, len(q))
 	for subspaceIndex, protoIndex := range q {
 		indices[subspaceIndex] = uint16(subspaceIndex*lutCols) + uint16(protoIndex)
@@ -83,41 +160,279 @@ func (m *Maddness[F]) LookupTableIndices(q []uint8) []uint16 {
 // DotProduct computes the approximated dot product between a data vector,
 // identified by the lookup-table indices obtained from the vector's
 // quantization, and the query vector represented by queryVectorIndex.
+//
+// The lookup-table entries are aggregated according to m.Aggregation,
+// and read according to the lookup table's own Precision.
+//
+// It panics if the metric of the lookup table is not MetricDotProduct.
 func (m *Maddness[F]) DotProduct(lutIndices []uint16, queryVectorIndex int) F {
 	lut := m.LookupTables[queryVectorIndex]
-	lutData := lut.Data
+	if lut.Metric != MetricDotProduct {
+		panic(fmt.Sprintf("maddness: lookup table %d has metric %s, expected %s", queryVectorIndex, lut.Metric, MetricDotProduct))
+	}
+	return m.approximate(lutIndices, lut)
+}
+
+// Distance computes the approximated squared Euclidean distance between a
+// data vector, identified by the lookup-table indices obtained from the
+// vector's quantization, and the query vector represented by
+// queryVectorIndex, as DotProduct does for dot products.
+//
+// It panics if the metric of the lookup table is not MetricSquaredL2.
+func (m *Maddness[F]) Distance(lutIndices []uint16, queryVectorIndex int) F {
+	lut := m.LookupTables[queryVectorIndex]
+	if lut.Metric != MetricSquaredL2 {
+		panic(fmt.Sprintf("maddness: lookup table %d has metric %s, expected %s", queryVectorIndex, lut.Metric, MetricSquaredL2))
+	}
+	return m.approximate(lutIndices, lut)
+}
+
+// NewLookupTable creates a new dot-product LookupTable for a query vector
+// not known at training time, with the same scaling, precision and
+// rounding as m.LookupTables. The table is not added to m.
+//
+// It panics if the size of query differs from m.VectorSize.
+func (m *Maddness[F]) NewLookupTable(query Vector[F]) *LookupTable[F] {
+	if len(query) != m.VectorSize {
+		panic(fmt.Sprintf("maddness: query vector has size %d, expected %d", len(query), m.VectorSize))
+	}
+	return m.makeLookupTable(query, MetricDotProduct, m.RandomSeed)
+}
+
+// DotProductWith is like DotProduct, but the query vector is represented
+// by the given lookup table, as returned by NewLookupTable.
+//
+// It panics if the metric of the lookup table is not MetricDotProduct.
+func (m *Maddness[F]) DotProductWith(lut *LookupTable[F], lutIndices []uint16) F {
+	if lut.Metric != MetricDotProduct {
+		panic(fmt.Sprintf("maddness: lookup table has metric %s, expected %s", lut.Metric, MetricDotProduct))
+	}
+	return m.approximate(lutIndices, lut)
+}
+
+// CosineSimilarity computes the approximated cosine similarity between a
+// data vector, identified by the lookup-table indices obtained from the
+// vector's quantization, and the query vector represented by
+// queryVectorIndex.
+//
+// The approximated dot product is divided by the norm of the query vector,
+// stored in the lookup table, and by the norm of the data vector,
+// approximated by QuantizedNorm. It returns zero if either norm is zero.
+//
+// It panics if the metric of the lookup table is not MetricDotProduct.
+func (m *Maddness[F]) CosineSimilarity(lutIndices []uint16, queryVectorIndex int) F {
+	lut := m.LookupTables[queryVectorIndex]
+	if lut.Metric != MetricDotProduct {
+		panic(fmt.Sprintf("maddness: lookup table %d has metric %s, expected %s", queryVectorIndex, lut.Metric, MetricDotProduct))
+	}
+	return m.cosineSimilarity(lutIndices, lut)
+}
+
+// CosineSimilarityWith is like CosineSimilarity, but the query vector is
+// represented by the given lookup table, as returned by NewLookupTable.
+//
+// It panics if the metric of the lookup table is not MetricDotProduct.
+func (m *Maddness[F]) CosineSimilarityWith(lut *LookupTable[F], lutIndices []uint16) F {
+	if lut.Metric != MetricDotProduct {
+		panic(fmt.Sprintf("maddness: lookup table has metric %s, expected %s", lut.Metric, MetricDotProduct))
+	}
+	return m.cosineSimilarity(lutIndices, lut)
+}
+
+func (m *Maddness[F]) cosineSimilarity(lutIndices []uint16, lut *LookupTable[F]) F {
+	norms := lut.QueryNorm * m.QuantizedNorm(lutIndices)
+	if norms == 0 {
+		return 0
+	}
+	return m.approximate(lutIndices, lut) / norms
+}
+
+// TopK returns the indices of the k lookup tables (query vectors) with the
+// highest approximated dot products with the data vector identified by the
+// given lookup-table indices, best first, together with their scores.
+// This is the typical use of a model replacing a classification layer,
+// where only the best classes are needed.
+//
+// With integer precisions (and without AggregationAveraging), the entries
+// of each table are summed as integers, and once k candidates are found,
+// each sum is compared with the worst of them in the integer domain of its
+// table: only the sums that may enter the top k are de-quantized. The
+// scores are the same as DotProduct's. Ties are resolved in favor of the
+// lower index. If k is greater than the number of lookup tables, all of
+// them are returned, and if k is zero, none.
+//
+// It panics if k is negative, or if the metric of any lookup table is not
+// MetricDotProduct.
+func (m *Maddness[F]) TopK(lutIndices []uint16, k int) (indices []int, scores Vector[F]) {
+	if k < 0 {
+		panic(fmt.Sprintf("maddness: invalid negative k %d", k))
+	}
+	h := newResultHeap[F](k, MetricDotProduct)
+	for i, lut := range m.LookupTables {
+		if lut.Metric != MetricDotProduct {
+			panic(fmt.Sprintf("maddness: lookup table %d has metric %s, expected %s", i, lut.Metric, MetricDotProduct))
+		}
+		sum, ok := lut.integerSum(lutIndices, m.Aggregation)
+		if !ok {
+			h.offer(i, m.approximate(lutIndices, lut))
+			continue
+		}
+		if worst, full := h.worst(); full && !lut.mayExceed(sum, worst) {
+			continue
+		}
+		h.offer(i, F(sum)/lut.Scale+lut.Bias)
+	}
+	h.sort()
 
-	var sum uint16
-	for _, lutIndex := range lutIndices {
-		ldi := lutData[lutIndex]
-		sum += uint16(ldi)
+	indices = make([]int, len(h.results))
+	scores = make(Vector[F], len(h.results))
+	for i, r := range h.results {
+		indices[i], scores[i] = r.Index, r.Score
 	}
+	return indices, scores
+}
+
+// QuantizedNorm returns the Euclidean norm of the data vector identified
+// by the given lookup-table indices, approximated by the norm of its
+// reconstruction (see Reconstruct). Since the subspaces are disjoint, and
+// the rotation preserves norms, it is computed from the stored
+// PrototypeSquaredNorms, with one addition per subspace.
+//
+// If the model has no PrototypeSquaredNorms, the norms of the prototypes
+// are computed on each call.
+func (m *Maddness[F]) QuantizedNorm(lutIndices []uint16) F {
+	var sum F
+	if m.PrototypeSquaredNorms != nil {
+		for _, i := range lutIndices {
+			sum += m.PrototypeSquaredNorms[i]
+		}
+		return F(math.Sqrt(float64(sum)))
+	}
+	lutCols := m.Encoders[0].NumCodes()
+	for subspaceIndex, lutIndex := range lutIndices {
+		proto := m.Encoders[subspaceIndex].Prototypes()[int(lutIndex)-subspaceIndex*lutCols]
+		sum += proto.DotProduct(proto)
+	}
+	return F(math.Sqrt(float64(sum)))
+}
+
+// prototypeSquaredNorms returns the squared norms of the prototypes of all
+// encoders, in the same order as the entries of a lookup table.
+func (m *Maddness[F]) prototypeSquaredNorms() Vector[F] {
+	norms := make(Vector[F], 0, len(m.Encoders)*m.Encoders[0].NumCodes())
+	for _, e := range m.Encoders {
+		for _, p := range e.Prototypes() {
+			norms = append(norms, p.DotProduct(p))
+		}
+	}
+	return norms
+}
 
-	return F(sum)/lut.Scale + lut.Bias
+// approximate returns the approximated value of the metric of lut for
+// the data vector identified by the given lookup-table indices.
+func (m *Maddness[F]) approximate(lutIndices []uint16, lut *LookupTable[F]) F {
+	return lut.sum(lutIndices, m.Aggregation)/lut.Scale + lut.Bias
+}
+
+// QuantizeMatrix quantizes each row of x, as Quantize does, returning
+// a slice of hash indices for each row.
+func (m *Maddness[F]) QuantizeMatrix(x Matrix[F]) [][]uint8 {
+	qs := make([][]uint8, x.Rows)
+	for i := range qs {
+		qs[i] = m.Quantize(x.Row(i))
+	}
+	return qs
+}
+
+// MatMul computes the approximated dot products between each row of x and
+// each query vector, returning a new Matrix whose rows correspond to the
+// rows of x, and whose columns correspond to the query vectors.
+//
+// The columns of lookup tables with MetricSquaredL2 hold the approximated
+// squared distances instead.
+//
+// It panics if the number of columns of x differs from m.VectorSize.
+func (m *Maddness[F]) MatMul(x Matrix[F]) Matrix[F] {
+	if x.Cols != m.VectorSize {
+		panic(fmt.Sprintf("maddness: matrix has %d columns, expected %d", x.Cols, m.VectorSize))
+	}
+	return m.matMul(x.Rows, x.Row)
+}
+
+// MatMulVectors is like MatMul, but data vectors are given as Vectors.
+func (m *Maddness[F]) MatMulVectors(vs Vectors[F]) Matrix[F] {
+	return m.matMul(len(vs), func(i int) Vector[F] { return vs[i] })
+}
+
+func (m *Maddness[F]) matMul(rows int, row func(int) Vector[F]) Matrix[F] {
+	out := NewMatrix[F](rows, len(m.LookupTables))
+	for i := 0; i < rows; i++ {
+		lutIndices := m.LookupTableIndices(m.Quantize(row(i)))
+		outRow := out.Row(i)
+		for j, lut := range m.LookupTables {
+			outRow[j] = m.approximate(lutIndices, lut)
+		}
+	}
+	return out
+}
+
+// SubspaceBounds returns the range [begin, end) of the vector elements
+// belonging to the i-th subspace.
+func (m *Maddness[F]) SubspaceBounds(i int) (begin, end int) {
+	if m.SubspaceOffsets != nil {
+		return m.SubspaceOffsets[i], m.SubspaceOffsets[i+1]
+	}
+	return i * m.SubVectorSize, (i + 1) * m.SubVectorSize
+}
+
+// subspaceOffsets returns the boundaries of numSubspaces subspaces of
+// vectors with the given size, or nil if the size is a multiple of
+// numSubspaces, and all subspaces have the same size.
+//
+// Otherwise, the sizes of the subspaces differ by at most one, with the
+// larger subspaces coming first.
+func subspaceOffsets(vecSize, numSubspaces int) []int {
+	if vecSize%numSubspaces == 0 {
+		return nil
+	}
+	size, remainder := vecSize/numSubspaces, vecSize%numSubspaces
+	offsets := make([]int, numSubspaces+1)
+	for i := 0; i < numSubspaces; i++ {
+		offsets[i+1] = offsets[i] + size
+		if i < remainder {
+			offsets[i+1]++
+		}
+	}
+	return offsets
 }
 
 // Reconstruct builds a vector from a list of hash indices, reconstructed
 // using the learned prototypes for each subspace.
 func (m *Maddness[F]) Reconstruct(q []uint8) Vector[F] {
+	return m.unrotate(m.reconstructRotated(q))
+}
+
+// reconstructRotated is like Reconstruct, without reverting the rotation.
+func (m *Maddness[F]) reconstructRotated(q []uint8) Vector[F] {
 	v := make(Vector[F], 0, m.VectorSize)
-	for i, hash := range m.Hashes {
-		v = append(v, hash.Prototypes[q[i]]...)
+	for i, e := range m.Encoders {
+		v = append(v, e.Prototypes()[q[i]]...)
 	}
-	return v
+	return m.unpermute(v)
 }
 
-func (m *Maddness[F]) trainAllHashes(examples Vectors[F]) {
+func (m *Maddness[F]) trainAllEncoders(examples Vectors[F], numCodes int) {
 	log.Printf("maddness: training %d subspaces with %d examples...", m.NumSubspaces, len(examples))
 
 	// Use a channel to limit concurrency.
 	concurrency := runtime.NumCPU()
 	ch := make(chan struct{}, concurrency)
 
-	m.Hashes = make([]*Hash[F], m.NumSubspaces)
-	for i := range m.Hashes {
+	m.Encoders = make([]Encoder[F], m.NumSubspaces)
+	for i := range m.Encoders {
 		ch <- struct{}{} // reserve one working slot, or wait for a free one
 		go func(subIndex int) {
-			m.trainSubspaceHash(subIndex, examples)
+			m.trainSubspaceEncoder(subIndex, examples, numCodes)
 			<-ch // free the slot
 		}(i)
 	}
@@ -130,78 +445,78 @@ func (m *Maddness[F]) trainAllHashes(examples Vectors[F]) {
 	log.Print("maddness: subspaces training completed.")
 }
 
-func (m *Maddness[F]) trainSubspaceHash(subIndex int, allExamples Vectors[F]) {
+func (m *Maddness[F]) trainSubspaceEncoder(subIndex int, allExamples Vectors[F], numCodes int) {
 	log.Printf("maddness: training subspace %d of %d...", subIndex+1, m.NumSubspaces)
 
 	subExamples := m.subspaceExamples(subIndex, allExamples)
-	m.Hashes[subIndex] = TrainHash(subExamples)
+	switch m.Encoding {
+	case EncodingPQ:
+		rng := rand.New(rand.NewSource(m.RandomSeed + int64(subIndex)))
+		m.Encoders[subIndex] = TrainPQEncoder(subExamples, numCodes, rng)
+	case EncodingBolt:
+		rng := rand.New(rand.NewSource(m.RandomSeed + int64(subIndex)))
+		m.Encoders[subIndex] = TrainBoltEncoder(subExamples, rng)
+	case EncodingUnbalancedTree:
+		m.Encoders[subIndex] = TrainUnbalancedTree(subExamples, numUnbalancedTreeLeaves)
+	default:
+		m.Encoders[subIndex] = TrainHash(subExamples)
+	}
 }
 
-func (m *Maddness[F]) makeLookupTables(queryVectors Vectors[F]) {
+func (m *Maddness[F]) makeLookupTables(queryVectors Vectors[F], metrics []Metric) {
 	log.Printf("maddness: creating lookup tables with %d query vectors...", len(queryVectors))
 
 	m.LookupTables = make([]*LookupTable[F], len(queryVectors))
 	for i, qv := range queryVectors {
-		m.LookupTables[i] = m.makeLookupTable(qv)
+		m.LookupTables[i] = m.makeLookupTable(qv, metrics[i], m.RandomSeed+int64(i))
 	}
 
 	log.Print("maddness: lookup tables created.")
 }
 
-func (m *Maddness[F]) makeLookupTable(queryVector Vector[F]) *LookupTable[F] {
-	floatData, min, scale := m.precomputeDotProducts(queryVector)
+// makeLookupTable creates a new LookupTable for the given query vector
+// and metric. The seed is only used with RoundingStochastic.
+func (m *Maddness[F]) makeLookupTable(queryVector Vector[F], metric Metric, seed int64) *LookupTable[F] {
+	floatData := m.precompute(m.permute(m.rotate(queryVector)), metric)
 
-	rows := len(floatData)
-	cols := len(floatData[0])
-
-	data := make([]uint8, 0, rows*cols)
-	for _, fdRow := range floatData {
-		for _, v := range fdRow {
-			data = append(data, uint8((v-min)*scale))
-		}
-	}
-
-	return &LookupTable[F]{
-		Bias:  min * F(m.NumSubspaces),
-		Scale: scale,
-		Data:  data,
+	var rng *rand.Rand
+	if m.Rounding == RoundingStochastic {
+		rng = rand.New(rand.NewSource(seed))
 	}
+	lut := newLookupTable(floatData, m.Scaling, m.Precision, rng)
+	lut.Metric = metric
+	lut.QueryNorm = queryVector.Norm()
+	return lut
 }
 
-func (m *Maddness[F]) precomputeDotProducts(vec Vector[F]) (data Vectors[F], min, scale F) {
-	data = make(Vectors[F], m.NumSubspaces)
-	min = F(math.Inf(1))
-	max := F(math.Inf(-1))
-
+// precompute returns the values of the metric between each sub-vector of
+// vec and each prototype of its subspace.
+func (m *Maddness[F]) precompute(vec Vector[F], metric Metric) Vectors[F] {
+	data := make(Vectors[F], m.NumSubspaces)
 	for i := range data {
-		subOffset := i * m.SubVectorSize
-		subVec := vec[subOffset : subOffset+m.SubVectorSize]
+		begin, end := m.SubspaceBounds(i)
+		subVec := vec[begin:end]
 
-		protos := m.Hashes[i].Prototypes
+		protos := m.Encoders[i].Prototypes()
 		dataRow := make(Vector[F], len(protos))
 		for j, proto := range protos {
-			v := subVec.DotProduct(proto)
-			dataRow[j] = v
-			if v < min {
-				min = v
-			}
-			if v > max {
-				max = v
+			if metric == MetricSquaredL2 {
+				dataRow[j] = subVec.SquaredDistance(proto)
+			} else {
+				dataRow[j] = subVec.DotProduct(proto)
 			}
 		}
 		data[i] = dataRow
 	}
-	scale = math.MaxUint8 / (max - min)
-	return
+	return data
 }
 
 func (m *Maddness[F]) subspaceExamples(subIndex int, allExamples Vectors[F]) Vectors[F] {
-	offset := subIndex * m.SubVectorSize
-	end := offset + m.SubVectorSize
+	begin, end := m.SubspaceBounds(subIndex)
 
 	subExamples := make(Vectors[F], len(allExamples))
 	for i, ex := range allExamples {
-		subExamples[i] = ex[offset:end]
+		subExamples[i] = ex[begin:end]
 	}
 
 	return subExamples
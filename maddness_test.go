@@ -5,7 +5,9 @@
 package gomaddness
 
 import (
+	"math"
 	"reflect"
+	"sort"
 	"testing"
 )
 
@@ -87,3 +89,293 @@ func testTrainMaddness[F Float](t *testing.T) {
 		}
 	}
 }
+
+func TestTrainMaddness_unevenSubspaces(t *testing.T) {
+	t.Run("float32", testTrainMaddnessUnevenSubspaces[float32])
+	t.Run("float64", testTrainMaddnessUnevenSubspaces[float64])
+}
+
+func testTrainMaddnessUnevenSubspaces[F Float](t *testing.T) {
+	examples, queryVectors := randomExamples[F](256, 10, 2)
+
+	m := TrainMaddness(examples, queryVectors, 4)
+	if m.SubVectorSize != 3 {
+		t.Errorf("SubVectorSize: expected 3, actual %d", m.SubVectorSize)
+	}
+	expectedOffsets := []int{0, 3, 6, 8, 10}
+	if !reflect.DeepEqual(m.SubspaceOffsets, expectedOffsets) {
+		t.Errorf("SubspaceOffsets: expected %v, actual %v", expectedOffsets, m.SubspaceOffsets)
+	}
+	for i, e := range m.Encoders {
+		begin, end := m.SubspaceBounds(i)
+		if size := len(e.Prototypes()[0]); size != end-begin {
+			t.Errorf("subspace %d: expected prototypes of size %d, actual %d", i, end-begin, size)
+		}
+	}
+	if err := m.checkStructure(); err != nil {
+		t.Error(err)
+	}
+
+	for _, x := range examples[:16] {
+		q := m.Quantize(x)
+		r := m.Reconstruct(q)
+		if len(r) != m.VectorSize {
+			t.Fatalf("expected reconstruction of size %d, actual %d", m.VectorSize, len(r))
+		}
+		lutIndices := m.LookupTableIndices(q)
+		for j, qv := range queryVectors {
+			// The product with the reconstructed vector is only affected
+			// by the quantization of the lookup tables.
+			expected := r.DotProduct(qv)
+			tolerance := float64(m.LookupTables[j].MaxError)*float64(m.NumSubspaces) + 1e-4
+			if actual := m.DotProduct(lutIndices, j); math.Abs(float64(actual-expected)) > tolerance {
+				t.Errorf("expected %v, actual %v", expected, actual)
+			}
+		}
+	}
+
+	if m2 := TrainMaddness(examples, queryVectors, 5); m2.SubspaceOffsets != nil {
+		t.Errorf("expected nil SubspaceOffsets with even subspaces, actual %v", m2.SubspaceOffsets)
+	}
+}
+
+func TestMaddness_Quantize_nearestPrototype(t *testing.T) {
+	t.Run("float32", testMaddnessQuantizeNearestPrototype[float32])
+	t.Run("float64", testMaddnessQuantizeNearestPrototype[float64])
+}
+
+func testMaddnessQuantizeNearestPrototype[F Float](t *testing.T) {
+	examples, queryVectors := randomExamples[F](256, 12, 2)
+
+	m := TrainMaddness(examples, queryVectors, 3, WithPartitioning(PartitioningVarianceBalanced))
+	var treeError, nearestError float64
+	differ := false
+	for _, x := range examples {
+		m.Assignment = AssignmentEncoder
+		treeCodes := m.Quantize(x)
+		m.Assignment = AssignmentNearestPrototype
+		q := m.Quantize(x)
+
+		p := m.permute(x)
+		for i, e := range m.Encoders {
+			begin, end := m.SubspaceBounds(i)
+			if expected := nearestPrototype(e.Prototypes(), p[begin:end]); int(q[i]) != expected {
+				t.Fatalf("subspace %d: expected code %d, actual %d", i, expected, q[i])
+			}
+		}
+		differ = differ || !reflect.DeepEqual(q, treeCodes)
+		treeError += float64(m.Reconstruct(treeCodes).SquaredDistance(x))
+		nearestError += float64(m.Reconstruct(q).SquaredDistance(x))
+	}
+	if !differ {
+		t.Error("expected some codes to differ from the hashing trees'")
+	}
+	if nearestError > treeError {
+		t.Errorf("expected nearest-prototype error %v not greater than hashing-tree error %v", nearestError, treeError)
+	}
+}
+
+func TestMaddness_Distance(t *testing.T) {
+	t.Run("float32", testMaddnessDistance[float32])
+	t.Run("float64", testMaddnessDistance[float64])
+}
+
+func testMaddnessDistance[F Float](t *testing.T) {
+	examples, queryVectors := randomExamples[F](256, 12, 2)
+
+	m := TrainMaddness(examples, queryVectors, 3,
+		WithQueryMetrics(MetricSquaredL2, MetricDotProduct), WithRotation(1), WithPartitioning(PartitioningCorrelated))
+	if m.LookupTables[0].Metric != MetricSquaredL2 || m.LookupTables[1].Metric != MetricDotProduct {
+		t.Fatalf("unexpected metrics %s and %s", m.LookupTables[0].Metric, m.LookupTables[1].Metric)
+	}
+
+	product := m.MatMulVectors(examples[:16])
+	for i, x := range examples[:16] {
+		q := m.Quantize(x)
+		r := m.Reconstruct(q)
+		lutIndices := m.LookupTableIndices(q)
+
+		// The distance from the reconstructed vector is only affected by
+		// the quantization of the lookup table.
+		expected := r.SquaredDistance(queryVectors[0])
+		tolerance := float64(m.LookupTables[0].MaxError)*float64(m.NumSubspaces) + 1e-3
+		actual := m.Distance(lutIndices, 0)
+		if math.Abs(float64(actual-expected)) > tolerance {
+			t.Errorf("expected distance %v, actual %v", expected, actual)
+		}
+		if p := product.Row(i); p[0] != actual || p[1] != m.DotProduct(lutIndices, 1) {
+			t.Errorf("unexpected product row %v", p)
+		}
+	}
+
+	for name, f := range map[string]func(){
+		"DotProduct": func() { m.DotProduct(m.LookupTableIndices(m.Quantize(examples[0])), 0) },
+		"Distance":   func() { m.Distance(m.LookupTableIndices(m.Quantize(examples[0])), 1) },
+	} {
+		t.Run(name+" with another metric", func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("expected panic")
+				}
+			}()
+			f()
+		})
+	}
+}
+
+func TestMaddness_DotProductWith(t *testing.T) {
+	t.Run("float32", testMaddnessDotProductWith[float32])
+	t.Run("float64", testMaddnessDotProductWith[float64])
+}
+
+func testMaddnessDotProductWith[F Float](t *testing.T) {
+	examples, queryVectors := randomExamples[F](256, 12, 2)
+	m := TrainMaddness(examples, queryVectors, 3, WithRounding(RoundingStochastic))
+
+	if lut := m.NewLookupTable(queryVectors[0]); !reflect.DeepEqual(lut, m.LookupTables[0]) {
+		t.Error("expected the same lookup table built at training time")
+	}
+
+	// The query is not one of the training-time query vectors.
+	query := examples[100]
+	lut := m.NewLookupTable(query)
+	if len(m.LookupTables) != 2 {
+		t.Fatalf("expected 2 lookup tables, actual %d", len(m.LookupTables))
+	}
+	for _, x := range examples[:16] {
+		q := m.Quantize(x)
+		expected := m.Reconstruct(q).DotProduct(query)
+		tolerance := float64(lut.MaxError)*float64(m.NumSubspaces) + 1e-4
+		if actual := m.DotProductWith(lut, m.LookupTableIndices(q)); math.Abs(float64(actual-expected)) > tolerance {
+			t.Errorf("expected %v, actual %v", expected, actual)
+		}
+	}
+}
+
+func TestMaddness_CosineSimilarity(t *testing.T) {
+	t.Run("float32", testMaddnessCosineSimilarity[float32])
+	t.Run("float64", testMaddnessCosineSimilarity[float64])
+}
+
+func testMaddnessCosineSimilarity[F Float](t *testing.T) {
+	examples, queryVectors := randomExamples[F](256, 12, 2)
+	m := TrainMaddness(examples, queryVectors, 3, WithRotation(1))
+	for i, lut := range m.LookupTables {
+		if expected := queryVectors[i].Norm(); lut.QueryNorm != expected {
+			t.Errorf("lookup table %d: expected query norm %v, actual %v", i, expected, lut.QueryNorm)
+		}
+	}
+
+	// The query is not one of the training-time query vectors.
+	query := examples[100]
+	lut := m.NewLookupTable(query)
+	cosine := func(a, b Vector[F]) float64 {
+		return float64(a.DotProduct(b)) / float64(a.Norm()*b.Norm())
+	}
+	// Compared to the exact similarity with the original vector, the
+	// approximation can only add the error of the lookup table to the
+	// error of the reconstruction.
+	var sumError, sumReconstructionError, sumTolerance float64
+	for _, x := range examples[:64] {
+		q := m.Quantize(x)
+		r := m.Reconstruct(q)
+		lutIndices := m.LookupTableIndices(q)
+		if norm := m.QuantizedNorm(lutIndices); math.Abs(float64(norm-r.Norm())) > 1e-4 {
+			t.Errorf("expected norm %v, actual %v", r.Norm(), norm)
+		}
+
+		// The similarity with the reconstructed vector is only affected
+		// by the quantization of the lookup table.
+		actual := float64(m.CosineSimilarityWith(lut, lutIndices))
+		tolerance := float64(lut.MaxError)*float64(m.NumSubspaces)/float64(r.Norm()*query.Norm()) + 1e-4
+		if expected := cosine(r, query); math.Abs(actual-expected) > tolerance {
+			t.Errorf("expected %v, actual %v", expected, actual)
+		}
+		lut0 := m.LookupTables[0]
+		tolerance0 := float64(lut0.MaxError)*float64(m.NumSubspaces)/float64(r.Norm()*lut0.QueryNorm) + 1e-4
+		if expected, actual := cosine(r, queryVectors[0]), float64(m.CosineSimilarity(lutIndices, 0)); math.Abs(actual-expected) > tolerance0 {
+			t.Errorf("expected %v, actual %v", expected, actual)
+		}
+
+		sumError += math.Abs(actual - cosine(x, query))
+		sumReconstructionError += math.Abs(cosine(r, query) - cosine(x, query))
+		sumTolerance += tolerance
+	}
+	if sumError > sumReconstructionError+sumTolerance {
+		t.Errorf("expected mean error from the exact cosine similarity not greater than %v, actual %v",
+			(sumReconstructionError+sumTolerance)/64, sumError/64)
+	}
+
+	// Without the stored norms, they are computed from the prototypes.
+	lutIndices := m.LookupTableIndices(m.Quantize(query))
+	norm := m.QuantizedNorm(lutIndices)
+	m.PrototypeSquaredNorms = nil
+	if actual := m.QuantizedNorm(lutIndices); math.Abs(float64(actual-norm)) > 1e-4 {
+		t.Errorf("expected norm %v without stored norms, actual %v", norm, actual)
+	}
+
+	if s := m.CosineSimilarityWith(m.NewLookupTable(make(Vector[F], m.VectorSize)), m.LookupTableIndices(m.Quantize(query))); s != 0 {
+		t.Errorf("expected zero similarity with a zero query vector, actual %v", s)
+	}
+}
+
+func TestMaddness_TopK(t *testing.T) {
+	t.Run("float32", testMaddnessTopK[float32])
+	t.Run("float64", testMaddnessTopK[float64])
+}
+
+func testMaddnessTopK[F Float](t *testing.T) {
+	examples, queryVectors := randomExamples[F](256, 12, 20)
+
+	for name, opts := range map[string][]Option{
+		"uint16":    {WithPrecision(PrecisionUint16)},
+		"uint8":     {WithPrecision(PrecisionUint8), WithAggregation(AggregationExact)},
+		"averaging": {WithPrecision(PrecisionUint8), WithAggregation(AggregationAveraging)},
+		"float32":   {WithPrecision(PrecisionFloat32)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			m := TrainMaddness(examples, queryVectors, 3, opts...)
+			for _, x := range examples[:16] {
+				lutIndices := m.LookupTableIndices(m.Quantize(x))
+				indices, scores := m.TopK(lutIndices, 5)
+				if len(indices) != 5 || len(scores) != 5 {
+					t.Fatalf("expected 5 results, actual %d indices and %d scores", len(indices), len(scores))
+				}
+
+				expected := make([]int, len(queryVectors))
+				for j := range expected {
+					expected[j] = j
+				}
+				sort.SliceStable(expected, func(a, b int) bool {
+					return m.DotProduct(lutIndices, expected[a]) > m.DotProduct(lutIndices, expected[b])
+				})
+				if !reflect.DeepEqual(indices, expected[:5]) {
+					t.Errorf("expected indices %v, actual %v", expected[:5], indices)
+				}
+				for i, j := range indices {
+					if s := m.DotProduct(lutIndices, j); scores[i] != s {
+						t.Errorf("result %d: expected score %v, actual %v", i, s, scores[i])
+					}
+				}
+			}
+		})
+	}
+
+	m := TrainMaddness(examples, queryVectors, 3)
+	lutIndices := m.LookupTableIndices(m.Quantize(examples[0]))
+	if indices, _ := m.TopK(lutIndices, 100); len(indices) != len(queryVectors) {
+		t.Errorf("expected %d indices, actual %d", len(queryVectors), len(indices))
+	}
+	if indices, scores := m.TopK(lutIndices, 0); len(indices) != 0 || len(scores) != 0 {
+		t.Errorf("expected no results, actual %d indices and %d scores", len(indices), len(scores))
+	}
+
+	t.Run("negative k", func(t *testing.T) {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected panic")
+			}
+		}()
+		m.TopK(lutIndices, -1)
+	})
+}
@@ -0,0 +1,51 @@
+// Copyright 2022, NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gomaddness
+
+// MappedMaddness is a Maddness model backed by a memory-mapped file,
+// as returned by OpenMapped.
+//
+// The prototypes and the lookup-table data of the model share memory with
+// the mapped file, which is mapped read-only: they MUST NOT be modified,
+// and MUST NOT be used after Close.
+type MappedMaddness[F Float] struct {
+	*Maddness[F]
+	data []byte
+}
+
+// OpenMapped memory-maps the model file at the given path, as written by
+// Maddness.Save, returning a model ready to be used.
+//
+// Pages of the file are loaded only when accessed, and they are shared
+// among all processes mapping the same file.
+//
+// On platforms where memory mapping is not supported, the whole file
+// is read into memory instead.
+func OpenMapped[F Float](path string) (*MappedMaddness[F], error) {
+	data, err := mmapFile(path)
+	if err != nil {
+		return nil, err
+	}
+	m, err := decodeMaddness[F](data)
+	if err != nil {
+		_ = munmap(data)
+		return nil, err
+	}
+	return &MappedMaddness[F]{
+		Maddness: m,
+		data:     data,
+	}, nil
+}
+
+// Close unmaps the model file.
+func (mm *MappedMaddness[F]) Close() error {
+	if mm.data == nil {
+		return nil
+	}
+	err := munmap(mm.data)
+	mm.data = nil
+	mm.Maddness = nil
+	return err
+}
@@ -0,0 +1,72 @@
+// Copyright 2022, NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gomaddness
+
+// Matrix is a dense matrix of floating point values, backed by a single
+// slice, in row-major order.
+//
+// Unlike Vectors, whose rows are independently allocated, a Matrix can
+// wrap existing memory, such as the buffer of a tensor or a memory-mapped
+// file, without copying it.
+type Matrix[F Float] struct {
+	Rows int
+	Cols int
+	// Stride is the distance between the beginning of two consecutive rows
+	// within Data. It is greater than or equal to Cols.
+	Stride int
+	Data   []F
+}
+
+// NewMatrix creates a new zero-filled Matrix with the given dimensions.
+func NewMatrix[F Float](rows, cols int) Matrix[F] {
+	if rows < 0 || cols < 0 {
+		panic("maddness: invalid negative matrix dimensions")
+	}
+	return Matrix[F]{
+		Rows:   rows,
+		Cols:   cols,
+		Stride: cols,
+		Data:   make([]F, rows*cols),
+	}
+}
+
+// NewMatrixFromSlice creates a new Matrix backed by the given data,
+// without copying it.
+//
+// It panics if the dimensions are invalid, or if data is too short.
+func NewMatrixFromSlice[F Float](data []F, rows, cols, stride int) Matrix[F] {
+	if rows < 0 || cols < 0 {
+		panic("maddness: invalid negative matrix dimensions")
+	}
+	if stride < cols {
+		panic("maddness: invalid matrix stride (it must not be lower than the number of columns)")
+	}
+	if rows > 0 && len(data) < (rows-1)*stride+cols {
+		panic("maddness: matrix data is too short for the given dimensions")
+	}
+	return Matrix[F]{
+		Rows:   rows,
+		Cols:   cols,
+		Stride: stride,
+		Data:   data,
+	}
+}
+
+// Row returns the i-th row of the matrix. The row shares its memory
+// with the matrix.
+func (m Matrix[F]) Row(i int) Vector[F] {
+	offset := i * m.Stride
+	return m.Data[offset : offset+m.Cols : offset+m.Cols]
+}
+
+// Vectors returns a collection of all rows of the matrix, sharing their
+// memory with the matrix. Only the slice headers are allocated.
+func (m Matrix[F]) Vectors() Vectors[F] {
+	vs := make(Vectors[F], m.Rows)
+	for i := range vs {
+		vs[i] = m.Row(i)
+	}
+	return vs
+}
@@ -0,0 +1,104 @@
+// Copyright 2022, NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gomaddness
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewMatrixFromSlice(t *testing.T) {
+	t.Run("float32", testNewMatrixFromSlice[float32])
+	t.Run("float64", testNewMatrixFromSlice[float64])
+}
+
+func testNewMatrixFromSlice[F Float](t *testing.T) {
+	data := []F{
+		1, 2, 3, -1,
+		4, 5, 6, -1,
+		7, 8, 9,
+	}
+	m := NewMatrixFromSlice(data, 3, 3, 4)
+
+	expected := Vectors[F]{{1, 2, 3}, {4, 5, 6}, {7, 8, 9}}
+	if vs := m.Vectors(); !reflect.DeepEqual(expected, vs) {
+		t.Fatalf("expected %v, actual %v", expected, vs)
+	}
+
+	m.Row(1)[0] = 42
+	if data[4] != 42 {
+		t.Error("the row does not share memory with the matrix")
+	}
+
+	c := expected.Matrix()
+	if c.Rows != 3 || c.Cols != 3 || c.Stride != 3 || len(c.Data) != 9 {
+		t.Errorf("unexpected contiguous matrix %+v", c)
+	}
+	if !reflect.DeepEqual(expected, c.Vectors()) {
+		t.Errorf("expected %v, actual %v", expected, c.Vectors())
+	}
+
+	invalid := []struct {
+		name               string
+		data               []F
+		rows, cols, stride int
+	}{
+		{"negative rows", nil, -1, 1, 1},
+		{"stride lower than cols", make([]F, 6), 2, 3, 2},
+		{"data too short", make([]F, 5), 2, 3, 3},
+	}
+	for _, tc := range invalid {
+		t.Run(tc.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("expected panic")
+				}
+			}()
+			NewMatrixFromSlice(tc.data, tc.rows, tc.cols, tc.stride)
+		})
+	}
+}
+
+func TestMaddness_MatMul(t *testing.T) {
+	t.Run("float32", testMaddnessMatMul[float32])
+	t.Run("float64", testMaddnessMatMul[float64])
+}
+
+func testMaddnessMatMul[F Float](t *testing.T) {
+	examples := NewMatrixFromSlice([]F{
+		1, 2, 3, 1,
+		2, 4, 4, 2,
+		3, 6, 6, 3,
+		4, 8, 9, 4,
+		5, 10, 13, 10,
+		6, 12, 18, 11,
+		7, 14, 24, 12,
+		8, 16, 31, 13,
+	}, 8, 4, 4)
+	queryVectors := NewMatrixFromSlice([]F{1, 2, 3, 4, 4, 3, 2, 1}, 2, 4, 4)
+
+	m := TrainMaddnessMatrix(examples, queryVectors, 2)
+
+	out := m.MatMul(examples)
+	if out.Rows != 8 || out.Cols != 2 {
+		t.Fatalf("expected 8×2 result, actual %d×%d", out.Rows, out.Cols)
+	}
+	qs := m.QuantizeMatrix(examples)
+	for i, q := range qs {
+		if !reflect.DeepEqual(q, m.Quantize(examples.Row(i))) {
+			t.Errorf("row %d: unexpected quantization %v", i, q)
+		}
+		lutIndices := m.LookupTableIndices(q)
+		for j := 0; j < 2; j++ {
+			if expected := m.DotProduct(lutIndices, j); out.Row(i)[j] != expected {
+				t.Errorf("(%d, %d): expected %v, actual %v", i, j, expected, out.Row(i)[j])
+			}
+		}
+	}
+
+	if outV := m.MatMulVectors(examples.Vectors()); !reflect.DeepEqual(out, outV) {
+		t.Errorf("expected %v, actual %v", out, outV)
+	}
+}
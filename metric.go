@@ -0,0 +1,30 @@
+// Copyright 2022, NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gomaddness
+
+// Metric identifies the function of a query vector and a data vector
+// approximated by a LookupTable.
+type Metric uint8
+
+const (
+	// MetricDotProduct is the dot product, approximated by
+	// Maddness.DotProduct.
+	MetricDotProduct Metric = iota
+	// MetricSquaredL2 is the squared Euclidean distance, approximated by
+	// Maddness.Distance.
+	MetricSquaredL2
+)
+
+// String returns a human-readable name of the metric.
+func (m Metric) String() string {
+	switch m {
+	case MetricDotProduct:
+		return "dot-product"
+	case MetricSquaredL2:
+		return "squared-l2"
+	default:
+		return "unknown"
+	}
+}
@@ -0,0 +1,21 @@
+// Copyright 2022, NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !(aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris)
+
+package gomaddness
+
+import "os"
+
+// mmapFile reads the whole file at the given path into memory, since
+// memory mapping is not supported on this platform.
+func mmapFile(path string) ([]byte, error) {
+	return os.ReadFile(path)
+}
+
+// munmap does nothing, since memory mapping is not supported on this
+// platform.
+func munmap([]byte) error {
+	return nil
+}
@@ -0,0 +1,40 @@
+// Copyright 2022, NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+
+package gomaddness
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// mmapFile maps the whole file at the given path into memory, read-only.
+func mmapFile(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := fi.Size()
+	if size == 0 {
+		return nil, errors.New("maddness: cannot map an empty file")
+	}
+	if int64(int(size)) != size {
+		return nil, errors.New("maddness: file too large to be mapped")
+	}
+	return syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+}
+
+// munmap unmaps memory previously mapped with mmapFile.
+func munmap(b []byte) error {
+	return syscall.Munmap(b)
+}
@@ -0,0 +1,247 @@
+// Copyright 2022, NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package npy
+
+import (
+	"errors"
+	"io"
+
+	"github.com/nlpodyssey/gomaddness"
+)
+
+// ExportModel writes the parameters of a trained model to w, as a .npz
+// archive containing the following arrays, where S is the number of
+// subspaces, L the number of levels of each hashing tree, P the number
+// of prototypes of each subspace, D the size of the largest subspace, and
+// Q the number of lookup tables (query vectors):
+//
+//   - "split_indices" (S, L), int64: the split index of each tree level,
+//     relative to the subspace, only present with EncodingHashTree;
+//   - "split_thresholds" (S, P-1), float: the split thresholds of all
+//     tree levels, concatenated level by level (heap order), only present
+//     with EncodingHashTree;
+//   - "tree_nodes" (S, P-1, 3), int64: the split index and the two
+//     children of each node of the unbalanced trees (see
+//     gomaddness.TreeNode), only present with EncodingUnbalancedTree;
+//   - "tree_thresholds" (S, P-1), float: the split threshold of each node
+//     of the unbalanced trees, only present with EncodingUnbalancedTree;
+//   - "prototypes" (S, P, D), float: the prototypes of smaller subspaces
+//     are padded with zeros;
+//   - "subspace_offsets" (S+1,), int64: the boundaries of the subspaces,
+//     only present if they have different sizes;
+//   - "permutation" (V,), int64: the order in which the elements of the
+//     input vectors, of size V, are assigned to the subspaces, only present
+//     if the partitioning is not contiguous;
+//   - "rotation" (V, V), float: the rotation matrix, by which the input
+//     vectors are multiplied before the permutation, only present if
+//     learned;
+//   - "prototype_squared_norms" (S, P), float: the squared norms of the
+//     prototypes, only present if the model has them;
+//   - "luts" (Q, S, P): the lookup-table data, whose data type depends
+//     on the tables' precision (uint8, uint16, float16 or float32);
+//   - "lut_bias" (Q,) and "lut_scale" (Q,), float: the de-quantization
+//     parameters of each lookup table;
+//   - "lut_offsets" (Q, S), float: only present with per-subspace scaling;
+//   - "lut_query_norms" (Q,), float: the norm of each lookup table's query
+//     vector;
+//   - "lut_metrics" (Q,), int64: the metric of each lookup table (0 for
+//     dot product, 1 for squared Euclidean distance), only present if any
+//     table is not a dot-product table;
+//   - "num_subspaces", "vector_size" and "sub_vector_size", int64 scalars.
+//
+// Float arrays are float32 or float64, according to F.
+func ExportModel[F gomaddness.Float](w io.Writer, m *gomaddness.Maddness[F]) error {
+	if len(m.Encoders) == 0 {
+		return errors.New("npy: invalid model without encoders")
+	}
+	a := NewArchiveWriter(w)
+	if err := exportModel(a, m); err != nil {
+		return err
+	}
+	return a.Close()
+}
+
+func exportModel[F gomaddness.Float](a *ArchiveWriter, m *gomaddness.Maddness[F]) error {
+	numProtos := m.Encoders[0].NumCodes()
+	numLevels := 0
+	if h, ok := m.Encoders[0].(*gomaddness.Hash[F]); ok {
+		numLevels = len(h.TreeLevels)
+	}
+
+	var splitIndices, treeNodes []int64
+	var splitThresholds, treeThresholds []F
+	prototypes := make([]F, 0, m.NumSubspaces*numProtos*m.SubVectorSize)
+	for _, e := range m.Encoders {
+		switch e := e.(type) {
+		case *gomaddness.Hash[F]:
+			for _, level := range e.TreeLevels {
+				splitIndices = append(splitIndices, int64(level.SplitIndex))
+				splitThresholds = append(splitThresholds, level.SplitThresholds...)
+			}
+		case *gomaddness.UnbalancedTree[F]:
+			for _, node := range e.Nodes {
+				treeNodes = append(treeNodes, int64(node.SplitIndex), int64(node.Children[0]), int64(node.Children[1]))
+				treeThresholds = append(treeThresholds, node.SplitThreshold)
+			}
+		}
+		for _, p := range e.Prototypes() {
+			prototypes = append(prototypes, p...)
+			for j := len(p); j < m.SubVectorSize; j++ {
+				prototypes = append(prototypes, 0)
+			}
+		}
+	}
+
+	var arrays []namedArray
+	if m.Encoding == gomaddness.EncodingHashTree {
+		arrays = append(arrays,
+			namedArray{"split_indices", func(w io.Writer) error {
+				return WriteArray(w, []int{m.NumSubspaces, numLevels}, splitIndices)
+			}},
+			namedArray{"split_thresholds", func(w io.Writer) error {
+				return WriteArray(w, []int{m.NumSubspaces, numProtos - 1}, splitThresholds)
+			}},
+		)
+	}
+	if m.Encoding == gomaddness.EncodingUnbalancedTree {
+		arrays = append(arrays,
+			namedArray{"tree_nodes", func(w io.Writer) error {
+				return WriteArray(w, []int{m.NumSubspaces, numProtos - 1, 3}, treeNodes)
+			}},
+			namedArray{"tree_thresholds", func(w io.Writer) error {
+				return WriteArray(w, []int{m.NumSubspaces, numProtos - 1}, treeThresholds)
+			}},
+		)
+	}
+	arrays = append(arrays, []namedArray{
+		{"prototypes", func(w io.Writer) error {
+			return WriteArray(w, []int{m.NumSubspaces, numProtos, m.SubVectorSize}, prototypes)
+		}},
+		{"num_subspaces", scalar(m.NumSubspaces)},
+		{"vector_size", scalar(m.VectorSize)},
+		{"sub_vector_size", scalar(m.SubVectorSize)},
+	}...)
+	if m.SubspaceOffsets != nil {
+		arrays = append(arrays, namedArray{"subspace_offsets", intArray(m.SubspaceOffsets)})
+	}
+	if m.Permutation != nil {
+		arrays = append(arrays, namedArray{"permutation", intArray(m.Permutation)})
+	}
+	if m.Rotation != nil {
+		arrays = append(arrays, namedArray{"rotation", func(w io.Writer) error {
+			return WriteVectors(w, m.Rotation)
+		}})
+	}
+	if m.PrototypeSquaredNorms != nil {
+		arrays = append(arrays, namedArray{"prototype_squared_norms", func(w io.Writer) error {
+			return WriteArray(w, []int{m.NumSubspaces, numProtos}, m.PrototypeSquaredNorms)
+		}})
+	}
+	for _, arr := range arrays {
+		if err := writeArchiveArray(a, arr.name, arr.write); err != nil {
+			return err
+		}
+	}
+
+	if len(m.LookupTables) == 0 {
+		return nil
+	}
+	return exportLookupTables(a, m.LookupTables, m.NumSubspaces, numProtos)
+}
+
+func exportLookupTables[F gomaddness.Float](a *ArchiveWriter, luts []*gomaddness.LookupTable[F], numSubspaces, numProtos int) error {
+	precision := luts[0].Precision
+	hasOffsets := luts[0].Offsets != nil
+
+	var data []byte
+	bias := make([]F, len(luts))
+	scale := make([]F, len(luts))
+	queryNorms := make([]F, len(luts))
+	var offsets []F
+	metrics := make([]int64, len(luts))
+	hasMetrics := false
+	for i, lut := range luts {
+		if lut.Precision != precision || (lut.Offsets != nil) != hasOffsets {
+			return errors.New("npy: lookup tables with different precision or scaling")
+		}
+		data = append(data, lut.Data...)
+		bias[i] = lut.Bias
+		scale[i] = lut.Scale
+		queryNorms[i] = lut.QueryNorm
+		offsets = append(offsets, lut.Offsets...)
+		metrics[i] = int64(lut.Metric)
+		hasMetrics = hasMetrics || lut.Metric != gomaddness.MetricDotProduct
+	}
+
+	descr := map[gomaddness.Precision]string{
+		gomaddness.PrecisionUint8:   "|u1",
+		gomaddness.PrecisionUint16:  "<u2",
+		gomaddness.PrecisionFloat16: "<f2",
+		gomaddness.PrecisionFloat32: "<f4",
+	}[precision]
+	if descr == "" {
+		return errors.New("npy: unsupported lookup-table precision")
+	}
+
+	err := writeArchiveArray(a, "luts", func(w io.Writer) error {
+		return WriteRawArray(w, descr, []int{len(luts), numSubspaces, numProtos}, data)
+	})
+	if err == nil {
+		err = writeArchiveArray(a, "lut_bias", func(w io.Writer) error {
+			return WriteArray(w, []int{len(luts)}, bias)
+		})
+	}
+	if err == nil {
+		err = writeArchiveArray(a, "lut_scale", func(w io.Writer) error {
+			return WriteArray(w, []int{len(luts)}, scale)
+		})
+	}
+	if err == nil && hasOffsets {
+		err = writeArchiveArray(a, "lut_offsets", func(w io.Writer) error {
+			return WriteArray(w, []int{len(luts), numSubspaces}, offsets)
+		})
+	}
+	if err == nil {
+		err = writeArchiveArray(a, "lut_query_norms", func(w io.Writer) error {
+			return WriteArray(w, []int{len(luts)}, queryNorms)
+		})
+	}
+	if err == nil && hasMetrics {
+		err = writeArchiveArray(a, "lut_metrics", func(w io.Writer) error {
+			return WriteArray(w, []int{len(luts)}, metrics)
+		})
+	}
+	return err
+}
+
+// namedArray is an array of a .npz archive, written by the write function.
+type namedArray struct {
+	name  string
+	write func(io.Writer) error
+}
+
+func scalar(v int) func(io.Writer) error {
+	return func(w io.Writer) error {
+		return WriteArray(w, []int{}, []int64{int64(v)})
+	}
+}
+
+func intArray(vs []int) func(io.Writer) error {
+	return func(w io.Writer) error {
+		data := make([]int64, len(vs))
+		for i, v := range vs {
+			data[i] = int64(v)
+		}
+		return WriteArray(w, []int{len(data)}, data)
+	}
+}
+
+func writeArchiveArray(a *ArchiveWriter, name string, write func(io.Writer) error) error {
+	w, err := a.Create(name)
+	if err != nil {
+		return err
+	}
+	return write(w)
+}
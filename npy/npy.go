@@ -0,0 +1,449 @@
+// Copyright 2022, NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package npy reads and writes NumPy .npy files and .npz archives,
+// for exchanging data and trained models with the reference Python
+// implementation of MADDNESS.
+package npy
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"unsafe"
+
+	"github.com/nlpodyssey/gomaddness"
+	"github.com/nlpodyssey/gomaddness/internal/endian"
+	"github.com/nlpodyssey/gomaddness/internal/float16"
+)
+
+const magic = "\x93NUMPY"
+
+// Header describes the content of a .npy file.
+type Header struct {
+	// Descr is the NumPy data-type description, such as "<f4".
+	Descr string
+	// FortranOrder reports whether the data is stored in column-major
+	// order, rather than row-major (C) order.
+	FortranOrder bool
+	// Shape of the array.
+	Shape []int
+}
+
+// ReadVectors reads a .npy file containing a two-dimensional array,
+// returning its rows as Vectors.
+//
+// Floating point, signed and unsigned integer, and boolean data types
+// are supported, with any byte order, and they are converted to F.
+//
+// A one-dimensional array is read as a single vector, and a scalar as a
+// single vector of size one. An array with more dimensions is read as
+// the sequence of vectors along its last dimension, in row-major order.
+// Column-major (Fortran) order is only supported for two-dimensional
+// arrays.
+func ReadVectors[F gomaddness.Float](r io.Reader) (gomaddness.Vectors[F], error) {
+	h, err := ReadHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	if h.FortranOrder && len(h.Shape) > 2 {
+		return nil, fmt.Errorf("npy: unsupported Fortran order with shape %v", h.Shape)
+	}
+	rows, cols := 1, 1
+	for i, d := range h.Shape {
+		if i == len(h.Shape)-1 {
+			cols = d
+			break
+		}
+		if d != 0 && rows > math.MaxInt32/d {
+			return nil, fmt.Errorf("npy: array too large, with shape %v", h.Shape)
+		}
+		rows *= d
+	}
+	if cols != 0 && rows > math.MaxInt32/cols {
+		return nil, fmt.Errorf("npy: array too large, with shape %v", h.Shape)
+	}
+
+	values, err := readValues[F](r, h.Descr, rows*cols)
+	if err != nil {
+		return nil, err
+	}
+
+	vs := make(gomaddness.Vectors[F], rows)
+	for i := range vs {
+		if h.FortranOrder {
+			v := make(gomaddness.Vector[F], cols)
+			for j := range v {
+				v[j] = values[j*rows+i]
+			}
+			vs[i] = v
+			continue
+		}
+		vs[i] = values[i*cols : (i+1)*cols : (i+1)*cols]
+	}
+	return vs, nil
+}
+
+// WriteVectors writes vs to w as a .npy file, containing a two-dimensional
+// array of little-endian float32 or float64 values, according to F.
+func WriteVectors[F gomaddness.Float](w io.Writer, vs gomaddness.Vectors[F]) error {
+	cols := 0
+	if len(vs) > 0 {
+		cols = len(vs[0])
+	}
+	data := make([]F, 0, len(vs)*cols)
+	for _, v := range vs {
+		if len(v) != cols {
+			return errors.New("npy: vectors of different length")
+		}
+		data = append(data, v...)
+	}
+	return WriteArray(w, []int{len(vs), cols}, data)
+}
+
+// Number is a constraint that permits the numeric types which can be
+// written by WriteArray.
+type Number interface {
+	~float32 | ~float64 | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint8 | ~uint16 | ~uint32 | ~uint64
+}
+
+// WriteArray writes a .npy file to w, containing an array with the
+// given shape and data, in row-major order.
+//
+// The length of data must be equal to the product of the shape's
+// dimensions.
+func WriteArray[N Number](w io.Writer, shape []int, data []N) error {
+	size := 1
+	for _, d := range shape {
+		size *= d
+	}
+	if size != len(data) {
+		return fmt.Errorf("npy: shape %v does not match data length %d", shape, len(data))
+	}
+
+	h := Header{Descr: descr[N](), Shape: shape}
+	if err := WriteHeader(w, h); err != nil {
+		return err
+	}
+
+	buf := make([]byte, len(data)*itemSize[N]())
+	for i, x := range data {
+		putValue(buf[i*itemSize[N]():], x)
+	}
+	_, err := w.Write(buf)
+	return err
+}
+
+// WriteRawArray writes a .npy file to w, containing an array with the given
+// shape and data-type description, whose data is already encoded in raw.
+//
+// It is useful for data types with no Go counterpart, such as "<f2".
+func WriteRawArray(w io.Writer, descr string, shape []int, raw []byte) error {
+	if err := WriteHeader(w, Header{Descr: descr, Shape: shape}); err != nil {
+		return err
+	}
+	_, err := w.Write(raw)
+	return err
+}
+
+// ReadHeader reads the header of a .npy file.
+func ReadHeader(r io.Reader) (Header, error) {
+	var prefix [8]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		return Header{}, fmt.Errorf("npy: reading header: %w", err)
+	}
+	if string(prefix[:6]) != magic {
+		return Header{}, errors.New("npy: invalid magic string")
+	}
+
+	var headerLen int
+	switch major := prefix[6]; major {
+	case 1:
+		var b [2]byte
+		if _, err := io.ReadFull(r, b[:]); err != nil {
+			return Header{}, fmt.Errorf("npy: reading header: %w", err)
+		}
+		headerLen = int(binary.LittleEndian.Uint16(b[:]))
+	case 2, 3:
+		var b [4]byte
+		if _, err := io.ReadFull(r, b[:]); err != nil {
+			return Header{}, fmt.Errorf("npy: reading header: %w", err)
+		}
+		headerLen = int(binary.LittleEndian.Uint32(b[:]))
+	default:
+		return Header{}, fmt.Errorf("npy: unsupported format version %d", major)
+	}
+
+	header := make([]byte, headerLen)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return Header{}, fmt.Errorf("npy: reading header: %w", err)
+	}
+	return parseHeader(string(header))
+}
+
+// WriteHeader writes the header of a .npy file, using format version 1.0,
+// or 2.0 if the header is too large.
+func WriteHeader(w io.Writer, h Header) error {
+	dims := make([]string, len(h.Shape))
+	for i, d := range h.Shape {
+		dims[i] = strconv.Itoa(d)
+	}
+	shape := strings.Join(dims, ", ")
+	if len(h.Shape) == 1 {
+		shape += ","
+	}
+	fortranOrder := "False"
+	if h.FortranOrder {
+		fortranOrder = "True"
+	}
+	dict := fmt.Sprintf("{'descr': '%s', 'fortran_order': %s, 'shape': (%s), }", h.Descr, fortranOrder, shape)
+
+	// The whole header, including the newline, is padded with spaces
+	// to a multiple of 64 bytes.
+	var buf bytes.Buffer
+	buf.WriteString(magic)
+	prefixLen := len(magic) + 2 + 2
+	if len(dict)+1+prefixLen+64 > math.MaxUint16 {
+		prefixLen = len(magic) + 2 + 4
+	}
+	padding := (64 - (prefixLen+len(dict)+1)%64) % 64
+	headerLen := len(dict) + padding + 1
+
+	if prefixLen == len(magic)+2+2 {
+		buf.Write([]byte{1, 0})
+		_ = binary.Write(&buf, binary.LittleEndian, uint16(headerLen))
+	} else {
+		buf.Write([]byte{2, 0})
+		_ = binary.Write(&buf, binary.LittleEndian, uint32(headerLen))
+	}
+	buf.WriteString(dict)
+	buf.WriteString(strings.Repeat(" ", padding))
+	buf.WriteByte('\n')
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// parseHeader parses the Python dictionary literal of a .npy header.
+func parseHeader(s string) (Header, error) {
+	var h Header
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "{") || !strings.HasSuffix(s, "}") {
+		return h, errors.New("npy: invalid header")
+	}
+	s = strings.TrimSpace(s[1 : len(s)-1])
+
+	seen := make(map[string]bool, 3)
+	for len(s) > 0 {
+		key, rest, err := parseString(s)
+		if err != nil {
+			return h, err
+		}
+		rest = strings.TrimSpace(rest)
+		if !strings.HasPrefix(rest, ":") {
+			return h, errors.New("npy: invalid header")
+		}
+		rest = strings.TrimSpace(rest[1:])
+
+		switch key {
+		case "descr":
+			h.Descr, rest, err = parseString(rest)
+		case "fortran_order":
+			h.FortranOrder, rest, err = parseBool(rest)
+		case "shape":
+			h.Shape, rest, err = parseShape(rest)
+		default:
+			err = fmt.Errorf("npy: unexpected header key %q", key)
+		}
+		if err != nil {
+			return h, err
+		}
+		seen[key] = true
+
+		rest = strings.TrimSpace(rest)
+		rest = strings.TrimPrefix(rest, ",")
+		s = strings.TrimSpace(rest)
+	}
+
+	if !seen["descr"] || !seen["fortran_order"] || !seen["shape"] {
+		return h, errors.New("npy: incomplete header")
+	}
+	return h, nil
+}
+
+func parseString(s string) (value, rest string, err error) {
+	if len(s) == 0 || (s[0] != '\'' && s[0] != '"') {
+		return "", s, errors.New("npy: invalid header string")
+	}
+	end := strings.IndexByte(s[1:], s[0])
+	if end < 0 {
+		return "", s, errors.New("npy: invalid header string")
+	}
+	return s[1 : end+1], s[end+2:], nil
+}
+
+func parseBool(s string) (value bool, rest string, err error) {
+	switch {
+	case strings.HasPrefix(s, "True"):
+		return true, s[4:], nil
+	case strings.HasPrefix(s, "False"):
+		return false, s[5:], nil
+	default:
+		return false, s, errors.New("npy: invalid header boolean")
+	}
+}
+
+func parseShape(s string) (shape []int, rest string, err error) {
+	if !strings.HasPrefix(s, "(") {
+		return nil, s, errors.New("npy: invalid header shape")
+	}
+	end := strings.IndexByte(s, ')')
+	if end < 0 {
+		return nil, s, errors.New("npy: invalid header shape")
+	}
+	shape = make([]int, 0)
+	for _, d := range strings.Split(s[1:end], ",") {
+		d = strings.TrimSpace(d)
+		if d == "" {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimSuffix(d, "L"))
+		if err != nil || n < 0 {
+			return nil, s, errors.New("npy: invalid header shape")
+		}
+		shape = append(shape, n)
+	}
+	return shape, s[end+1:], nil
+}
+
+// readValues reads n values of the given NumPy data type, converting them
+// to F.
+func readValues[F gomaddness.Float](r io.Reader, descr string, n int) ([]F, error) {
+	if len(descr) < 3 {
+		return nil, fmt.Errorf("npy: unsupported data type %q", descr)
+	}
+	var order binary.ByteOrder
+	switch descr[0] {
+	case '<', '|':
+		order = binary.LittleEndian
+	case '>':
+		order = binary.BigEndian
+	case '=':
+		order = endian.Native()
+	default:
+		return nil, fmt.Errorf("npy: unsupported data type %q", descr)
+	}
+	kind := descr[1]
+	size, err := strconv.Atoi(descr[2:])
+	if err != nil {
+		return nil, fmt.Errorf("npy: unsupported data type %q", descr)
+	}
+	decode := decoder[F](kind, size, order)
+	if decode == nil {
+		return nil, fmt.Errorf("npy: unsupported data type %q", descr)
+	}
+
+	values := make([]F, n)
+	buf := make([]byte, 4096*size)
+	for i := 0; i < n; {
+		chunk := buf[:size*minInt(4096, n-i)]
+		if _, err := io.ReadFull(r, chunk); err != nil {
+			return nil, fmt.Errorf("npy: reading data: %w", err)
+		}
+		for j := 0; j < len(chunk); j += size {
+			values[i] = decode(chunk[j:])
+			i++
+		}
+	}
+	return values, nil
+}
+
+// decoder returns a function decoding a single value of the given kind
+// and size, or nil if the data type is not supported.
+func decoder[F gomaddness.Float](kind byte, size int, order binary.ByteOrder) func([]byte) F {
+	switch {
+	case kind == 'f' && size == 2:
+		return func(b []byte) F { return F(float16.ToFloat32(order.Uint16(b))) }
+	case kind == 'f' && size == 4:
+		return func(b []byte) F { return F(math.Float32frombits(order.Uint32(b))) }
+	case kind == 'f' && size == 8:
+		return func(b []byte) F { return F(math.Float64frombits(order.Uint64(b))) }
+	case (kind == 'u' || kind == 'b') && size == 1:
+		return func(b []byte) F { return F(b[0]) }
+	case kind == 'u' && size == 2:
+		return func(b []byte) F { return F(order.Uint16(b)) }
+	case kind == 'u' && size == 4:
+		return func(b []byte) F { return F(order.Uint32(b)) }
+	case kind == 'u' && size == 8:
+		return func(b []byte) F { return F(order.Uint64(b)) }
+	case kind == 'i' && size == 1:
+		return func(b []byte) F { return F(int8(b[0])) }
+	case kind == 'i' && size == 2:
+		return func(b []byte) F { return F(int16(order.Uint16(b))) }
+	case kind == 'i' && size == 4:
+		return func(b []byte) F { return F(int32(order.Uint32(b))) }
+	case kind == 'i' && size == 8:
+		return func(b []byte) F { return F(int64(order.Uint64(b))) }
+	default:
+		return nil
+	}
+}
+
+// descr returns the NumPy little-endian data-type description of N.
+func descr[N Number]() string {
+	kind := "f"
+	if !isFloat[N]() {
+		kind = "i"
+		if N(0)-1 > 0 {
+			kind = "u"
+		}
+	}
+	prefix := "<"
+	if itemSize[N]() == 1 {
+		prefix = "|"
+	}
+	return prefix + kind + strconv.Itoa(itemSize[N]())
+}
+
+// isFloat reports whether N is a floating point type.
+func isFloat[N Number]() bool {
+	x := N(1)
+	return x/2 != 0
+}
+
+// itemSize returns the size in bytes of N.
+func itemSize[N Number]() int {
+	var x N
+	return int(unsafe.Sizeof(x))
+}
+
+// putValue encodes x into b, in little-endian order.
+func putValue[N Number](b []byte, x N) {
+	size := itemSize[N]()
+	var bits uint64
+	switch {
+	case isFloat[N]() && size == 4:
+		bits = uint64(math.Float32bits(float32(x)))
+	case isFloat[N]():
+		bits = math.Float64bits(float64(x))
+	default:
+		bits = uint64(x)
+	}
+	for i := 0; i < size; i++ {
+		b[i] = byte(bits >> (8 * i))
+	}
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,223 @@
+// Copyright 2022, NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package npy
+
+import (
+	"bytes"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/nlpodyssey/gomaddness"
+)
+
+func TestWriteVectors(t *testing.T) {
+	t.Run("float32", testWriteVectors[float32])
+	t.Run("float64", testWriteVectors[float64])
+}
+
+func testWriteVectors[F gomaddness.Float](t *testing.T) {
+	vs := gomaddness.Vectors[F]{{1, 2, 3}, {4, 5, 6.5}}
+
+	var buf bytes.Buffer
+	if err := WriteVectors(&buf, vs); err != nil {
+		t.Fatal(err)
+	}
+
+	data := buf.Bytes()
+	headerLen := int(data[8]) | int(data[9])<<8
+	if (10+headerLen)%64 != 0 {
+		t.Errorf("header is not aligned to 64 bytes: %d", 10+headerLen)
+	}
+	if data[10+headerLen-1] != '\n' {
+		t.Error("header must end with a newline")
+	}
+
+	actual, err := ReadVectors[F](bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(vs, actual) {
+		t.Errorf("expected %v, actual %v", vs, actual)
+	}
+}
+
+func TestReadVectors(t *testing.T) {
+	testCases := []struct {
+		name     string
+		header   string
+		data     []byte
+		expected gomaddness.Vectors[float64]
+	}{
+		{
+			name:     "big-endian int16",
+			header:   "{'descr': '>i2', 'fortran_order': False, 'shape': (2, 2), }",
+			data:     []byte{0, 1, 0xff, 0xfe, 0x01, 0x00, 0, 0},
+			expected: gomaddness.Vectors[float64]{{1, -2}, {256, 0}},
+		},
+		{
+			name:     "fortran order",
+			header:   "{'descr': '|u1', 'fortran_order': True, 'shape': (2, 3), }",
+			data:     []byte{1, 4, 2, 5, 3, 6},
+			expected: gomaddness.Vectors[float64]{{1, 2, 3}, {4, 5, 6}},
+		},
+		{
+			name:     "float16 with python 2 long shape",
+			header:   "{'descr': '<f2', 'fortran_order': False, 'shape': (1L, 3L), }",
+			data:     []byte{0x00, 0x3c, 0x00, 0xc0, 0x00, 0x38},
+			expected: gomaddness.Vectors[float64]{{1, -2, 0.5}},
+		},
+		{
+			name:     "one-dimensional",
+			header:   "{'shape': (3,), 'fortran_order': False, 'descr': '|b1'}",
+			data:     []byte{1, 0, 1},
+			expected: gomaddness.Vectors[float64]{{1, 0, 1}},
+		},
+		{
+			name:     "scalar",
+			header:   `{"descr": "<i8", "fortran_order": False, "shape": ()}`,
+			data:     []byte{42, 0, 0, 0, 0, 0, 0, 0},
+			expected: gomaddness.Vectors[float64]{{42}},
+		},
+		{
+			name:     "three-dimensional",
+			header:   "{'descr': '|i1', 'fortran_order': False, 'shape': (2, 1, 2), }",
+			data:     []byte{1, 2, 3, 0xff},
+			expected: gomaddness.Vectors[float64]{{1, 2}, {3, -1}},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := ReadVectors[float64](bytes.NewReader(npyFile(tc.header, tc.data)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(tc.expected, actual) {
+				t.Errorf("expected %v, actual %v", tc.expected, actual)
+			}
+		})
+	}
+
+	invalid := []struct {
+		name string
+		data []byte
+	}{
+		{"bad magic", []byte("\x93NUMPX\x01\x00\x04\x00{ }\n")},
+		{"truncated header", []byte("\x93NUMPY\x01\x00\x50\x00{'descr'")},
+		{"missing shape", npyFile("{'descr': '<f4', 'fortran_order': False}", nil)},
+		{"unsupported type", npyFile("{'descr': '<c8', 'fortran_order': False, 'shape': (1,), }", make([]byte, 8))},
+		{"truncated data", npyFile("{'descr': '<f4', 'fortran_order': False, 'shape': (2,), }", make([]byte, 4))},
+	}
+	for _, tc := range invalid {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ReadVectors[float32](bytes.NewReader(tc.data))
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			t.Log(err)
+		})
+	}
+}
+
+// npyFile returns the content of a .npy file, version 1.0, with the given
+// header and data.
+func npyFile(header string, data []byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("\x93NUMPY\x01\x00")
+	buf.WriteByte(byte(len(header) + 1))
+	buf.WriteByte(0)
+	buf.WriteString(header + "\n")
+	buf.Write(data)
+	return buf.Bytes()
+}
+
+func TestExportModel(t *testing.T) {
+	t.Run("float32", testExportModel[float32])
+	t.Run("float64", testExportModel[float64])
+}
+
+func testExportModel[F gomaddness.Float](t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	examples := make(gomaddness.Vectors[F], 64)
+	for i := range examples {
+		examples[i] = make(gomaddness.Vector[F], 8)
+		for j := range examples[i] {
+			examples[i][j] = F(r.NormFloat64())
+		}
+	}
+	m := gomaddness.TrainMaddness(examples, examples[:3], 2, gomaddness.WithScaling(gomaddness.ScalingPerSubspace))
+
+	var buf bytes.Buffer
+	if err := ExportModel(&buf, m); err != nil {
+		t.Fatal(err)
+	}
+	arrays, err := ReadArchive[F](bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedRows := map[string]int{
+		"split_indices":           2,
+		"split_thresholds":        2,
+		"prototypes":              2 * 16,
+		"prototype_squared_norms": 2,
+		"luts":                    3 * 2,
+		"lut_bias":                1,
+		"lut_scale":               1,
+		"lut_offsets":             3,
+		"lut_query_norms":         1,
+		"num_subspaces":           1,
+		"vector_size":             1,
+		"sub_vector_size":         1,
+	}
+	if len(arrays) != len(expectedRows) {
+		t.Errorf("expected %d arrays, actual %d", len(expectedRows), len(arrays))
+	}
+	for name, rows := range expectedRows {
+		if len(arrays[name]) != rows {
+			t.Errorf("%s: expected %d rows, actual %d", name, rows, len(arrays[name]))
+		}
+	}
+
+	if !reflect.DeepEqual(arrays["prototypes"][17], m.Encoders[1].Prototypes()[1]) {
+		t.Errorf("unexpected prototype %v", arrays["prototypes"][17])
+	}
+	if thresholds := arrays["split_thresholds"][1]; thresholds[3] != m.Encoders[1].(*gomaddness.Hash[F]).TreeLevels[2].SplitThresholds[0] {
+		t.Errorf("unexpected thresholds %v", thresholds)
+	}
+	if v := arrays["luts"][5][7]; v != F(m.LookupTables[2].Data[16+7]) {
+		t.Errorf("unexpected lookup-table value %v", v)
+	}
+	if v := arrays["num_subspaces"][0][0]; v != 2 {
+		t.Errorf("expected 2 subspaces, actual %v", v)
+	}
+
+	t.Run("uneven subspaces, permutation and rotation", func(t *testing.T) {
+		m := gomaddness.TrainMaddness(examples, examples[:3], 3,
+			gomaddness.WithPartitioning(gomaddness.PartitioningVarianceBalanced), gomaddness.WithRotation(1))
+		var buf bytes.Buffer
+		if err := ExportModel(&buf, m); err != nil {
+			t.Fatal(err)
+		}
+		arrays, err := ReadArchive[F](bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if offsets := arrays["subspace_offsets"]; !reflect.DeepEqual(offsets, gomaddness.Vectors[F]{{0, 3, 6, 8}}) {
+			t.Errorf("unexpected subspace offsets %v", offsets)
+		}
+		if p := arrays["permutation"]; len(p) != 1 || len(p[0]) != 8 {
+			t.Errorf("unexpected permutation %v", p)
+		}
+		if rotation := arrays["rotation"]; !reflect.DeepEqual(rotation, m.Rotation) {
+			t.Errorf("expected rotation %v, actual %v", m.Rotation, rotation)
+		}
+		// The prototypes of the last subspace, of size 2, are padded.
+		expected := append(m.Encoders[2].Prototypes()[1].Copy(), 0)
+		if p := arrays["prototypes"][2*16+1]; !reflect.DeepEqual(p, expected) {
+			t.Errorf("expected prototype %v, actual %v", expected, p)
+		}
+	})
+}
@@ -0,0 +1,87 @@
+// Copyright 2022, NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package npy
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/nlpodyssey/gomaddness"
+)
+
+// ArchiveWriter writes a .npz archive, that is a zip file of .npy files.
+type ArchiveWriter struct {
+	zw *zip.Writer
+}
+
+// NewArchiveWriter creates a new ArchiveWriter writing to w.
+func NewArchiveWriter(w io.Writer) *ArchiveWriter {
+	return &ArchiveWriter{zw: zip.NewWriter(w)}
+}
+
+// Create adds a new array to the archive, with the given name, returning
+// a writer for its .npy content, such as WriteArray or WriteVectors.
+//
+// The content must be completely written before the next call to Create
+// or Close.
+func (a *ArchiveWriter) Create(name string) (io.Writer, error) {
+	return a.zw.CreateHeader(&zip.FileHeader{
+		Name:   name + ".npy",
+		Method: zip.Deflate,
+	})
+}
+
+// Close finishes writing the archive. It does not close the underlying
+// writer.
+func (a *ArchiveWriter) Close() error {
+	return a.zw.Close()
+}
+
+// ReadArchive reads all arrays from a .npz archive, as ReadVectors does,
+// returning them by name (without the ".npy" extension).
+func ReadArchive[F gomaddness.Float](r io.ReaderAt, size int64) (map[string]gomaddness.Vectors[F], error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("npy: reading archive: %w", err)
+	}
+
+	arrays := make(map[string]gomaddness.Vectors[F], len(zr.File))
+	for _, f := range zr.File {
+		vs, err := readArchiveFile[F](f)
+		if err != nil {
+			return nil, fmt.Errorf("npy: reading %q from archive: %w", f.Name, err)
+		}
+		arrays[strings.TrimSuffix(f.Name, ".npy")] = vs
+	}
+	return arrays, nil
+}
+
+// OpenArchive reads all arrays from the .npz archive at the given path,
+// as ReadArchive does.
+func OpenArchive[F gomaddness.Float](path string) (map[string]gomaddness.Vectors[F], error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return ReadArchive[F](f, fi.Size())
+}
+
+func readArchiveFile[F gomaddness.Float](f *zip.File) (gomaddness.Vectors[F], error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return ReadVectors[F](rc)
+}
@@ -0,0 +1,192 @@
+// Copyright 2022, NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gomaddness
+
+// An Option configures optional aspects of MADDNESS training.
+type Option func(*options)
+
+type options struct {
+	aggregation  Aggregation
+	scaling      Scaling
+	precision    Precision
+	rounding     Rounding
+	randomSeed   int64
+	partitioning Partitioning
+	encoding     Encoding
+	assignment   Assignment
+	metric       Metric
+	// metrics, if not nil, are the metrics of each query vector,
+	// overriding metric.
+	metrics  []Metric
+	numCodes int
+	// rotationIterations is the number of iterations for learning the
+	// rotation, zero meaning no rotation.
+	rotationIterations int
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{
+		aggregation:  AggregationExact,
+		scaling:      ScalingGlobal,
+		precision:    PrecisionUint8,
+		rounding:     RoundingNearest,
+		randomSeed:   1,
+		partitioning: PartitioningContiguous,
+		encoding:     EncodingHashTree,
+		assignment:   AssignmentEncoder,
+		metric:       MetricDotProduct,
+		numCodes:     256,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithAggregation sets the strategy used for aggregating the lookup-table
+// entries. The default is AggregationExact.
+func WithAggregation(a Aggregation) Option {
+	return func(o *options) {
+		o.aggregation = a
+	}
+}
+
+// WithScaling sets the strategy used for quantizing the lookup tables.
+// The default is ScalingGlobal.
+func WithScaling(s Scaling) Option {
+	return func(o *options) {
+		o.scaling = s
+	}
+}
+
+// WithPrecision sets the precision of the elements of the lookup tables.
+// The default is PrecisionUint8.
+func WithPrecision(p Precision) Option {
+	return func(o *options) {
+		o.precision = p
+	}
+}
+
+// WithRounding sets the strategy used for rounding the values of quantized
+// lookup tables. The default is RoundingNearest.
+func WithRounding(r Rounding) Option {
+	return func(o *options) {
+		o.rounding = r
+	}
+}
+
+// WithRandomSeed sets the seed for the pseudo-random number generators
+// used by the training process. The default is 1.
+func WithRandomSeed(seed int64) Option {
+	return func(o *options) {
+		o.randomSeed = seed
+	}
+}
+
+// WithPartitioning sets the strategy used for assigning the vector
+// elements to subspaces. The default is PartitioningContiguous.
+func WithPartitioning(p Partitioning) Option {
+	return func(o *options) {
+		o.partitioning = p
+	}
+}
+
+// WithEncoding sets the kind of Encoder learned for each subspace.
+// The default is EncodingHashTree.
+func WithEncoding(e Encoding) Option {
+	return func(o *options) {
+		o.encoding = e
+	}
+}
+
+// WithAssignment sets the strategy used by Quantize for assigning the
+// sub-vectors to prototypes. The default is AssignmentEncoder.
+func WithAssignment(a Assignment) Option {
+	return func(o *options) {
+		o.assignment = a
+	}
+}
+
+// WithMetric sets the metric of the lookup tables of all query vectors.
+// The default is MetricDotProduct.
+func WithMetric(m Metric) Option {
+	return func(o *options) {
+		o.metric = m
+	}
+}
+
+// WithQueryMetrics sets the metric of the lookup table of each query
+// vector, in the same order, so that dot products and distances can be
+// combined in the same model. The number of metrics must be equal to the
+// number of query vectors. It takes precedence over WithMetric.
+func WithQueryMetrics(metrics ...Metric) Option {
+	return func(o *options) {
+		o.metrics = metrics
+	}
+}
+
+// WithNumCodes sets the number of codes (centroids) of each subspace
+// with EncodingPQ, in the range [1, 256]. The default is 256.
+//
+// It has no effect on the other encodings, which always have 16 codes.
+func WithNumCodes(n int) Option {
+	return func(o *options) {
+		o.numCodes = n
+	}
+}
+
+// WithRotation enables learning an orthogonal rotation of the vectors
+// before splitting them into subspaces, as in Optimized Product
+// Quantization, with the given number of iterations (see
+// Maddness.Rotation). It reduces the error for data whose elements are
+// strongly correlated, at the cost of a matrix-vector multiplication for
+// each quantized vector, while the query vectors are rotated only once,
+// when building the lookup tables.
+//
+// Each iteration trains the encoders on a sample of the data examples.
+// The default is zero, meaning no rotation.
+func WithRotation(iterations int) Option {
+	return func(o *options) {
+		o.rotationIterations = iterations
+	}
+}
+
+// WithBolt configures the training as in Bolt: EncodingBolt, with 8-bit
+// lookup tables (PrecisionUint8) and ScalingPerSubspace. Options given
+// after it can override these settings.
+func WithBolt() Option {
+	return func(o *options) {
+		o.encoding = EncodingBolt
+		o.precision = PrecisionUint8
+		o.scaling = ScalingPerSubspace
+	}
+}
+
+// codesPerSubspace returns the number of codes of each encoder trained
+// with the options.
+func (o *options) codesPerSubspace() int {
+	switch o.encoding {
+	case EncodingPQ:
+		return o.numCodes
+	case EncodingBolt:
+		return BoltNumCodes
+	case EncodingUnbalancedTree:
+		return numUnbalancedTreeLeaves
+	default:
+		return 16 // hashing trees with 4 levels
+	}
+}
+
+// queryMetrics returns the metrics of n query vectors.
+func (o *options) queryMetrics(n int) []Metric {
+	if o.metrics != nil {
+		return o.metrics
+	}
+	metrics := make([]Metric, n)
+	for i := range metrics {
+		metrics[i] = o.metric
+	}
+	return metrics
+}
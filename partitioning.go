@@ -0,0 +1,242 @@
+// Copyright 2022, NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gomaddness
+
+import (
+	"math"
+	"sort"
+)
+
+// Partitioning identifies the strategy used for assigning the elements
+// of the vectors to subspaces.
+type Partitioning uint8
+
+const (
+	// PartitioningContiguous assigns contiguous ranges of elements to each
+	// subspace, in their original order.
+	PartitioningContiguous Partitioning = iota
+	// PartitioningVarianceBalanced assigns the elements to subspaces so
+	// that the total variance of each subspace is roughly the same,
+	// preventing a few subspaces from concentrating most of the error.
+	PartitioningVarianceBalanced
+	// PartitioningCorrelated groups strongly correlated elements into the
+	// same subspaces, so that the hashing trees and prototypes can
+	// capture their dependencies.
+	PartitioningCorrelated
+)
+
+// String returns a human-readable name of the partitioning strategy.
+func (p Partitioning) String() string {
+	switch p {
+	case PartitioningContiguous:
+		return "contiguous"
+	case PartitioningVarianceBalanced:
+		return "variance-balanced"
+	case PartitioningCorrelated:
+		return "correlated"
+	default:
+		return "unknown"
+	}
+}
+
+// maxPartitioningExamples is the maximum amount of data examples used for
+// computing the correlations between the vector elements. Larger datasets
+// are evenly sampled.
+const maxPartitioningExamples = 1024
+
+// learnPermutation returns the permutation of the vector elements that
+// implements m.Partitioning, or nil for PartitioningContiguous.
+func (m *Maddness[F]) learnPermutation(examples Vectors[F]) []int {
+	var subspaces [][]int
+	switch m.Partitioning {
+	case PartitioningVarianceBalanced:
+		subspaces = m.varianceBalancedSubspaces(examples.ColumnWiseVariance())
+	case PartitioningCorrelated:
+		subspaces = m.correlatedSubspaces(sampleExamples(examples, maxPartitioningExamples))
+	default:
+		return nil
+	}
+	permutation := make([]int, 0, m.VectorSize)
+	for _, s := range subspaces {
+		sort.Ints(s)
+		permutation = append(permutation, s...)
+	}
+	return permutation
+}
+
+// varianceBalancedSubspaces assigns the vector elements to subspaces,
+// one at a time, in decreasing order of variance, each one to the subspace
+// with the lowest total variance that is not full yet.
+func (m *Maddness[F]) varianceBalancedSubspaces(variance Vector[F]) [][]int {
+	elements := make([]int, len(variance))
+	for i := range elements {
+		elements[i] = i
+	}
+	sort.SliceStable(elements, func(a, b int) bool {
+		return variance[elements[a]] > variance[elements[b]]
+	})
+
+	subspaces := m.emptySubspaces()
+	totals := make([]F, m.NumSubspaces)
+	for _, e := range elements {
+		best := -1
+		for i, s := range subspaces {
+			if len(s) < cap(s) && (best < 0 || totals[i] < totals[best]) {
+				best = i
+			}
+		}
+		subspaces[best] = append(subspaces[best], e)
+		totals[best] += variance[e]
+	}
+	return subspaces
+}
+
+// correlatedSubspaces fills one subspace at a time, starting from the
+// unassigned element with the highest variance, and repeatedly adding the
+// unassigned element with the highest sum of absolute correlations with
+// the elements already in the subspace.
+func (m *Maddness[F]) correlatedSubspaces(examples Vectors[F]) [][]int {
+	variance, corr := correlations(examples)
+
+	assigned := make([]bool, m.VectorSize)
+	scores := make([]float64, m.VectorSize)
+	subspaces := m.emptySubspaces()
+	for i := range subspaces {
+		for j := range scores {
+			scores[j] = 0
+		}
+		for len(subspaces[i]) < cap(subspaces[i]) {
+			best := -1
+			for e := range scores {
+				if assigned[e] {
+					continue
+				}
+				if best < 0 ||
+					(len(subspaces[i]) == 0 && variance[e] > variance[best]) ||
+					(len(subspaces[i]) > 0 && scores[e] > scores[best]) {
+					best = e
+				}
+			}
+			assigned[best] = true
+			subspaces[i] = append(subspaces[i], best)
+			for e, c := range corr[best] {
+				scores[e] += math.Abs(c)
+			}
+		}
+	}
+	return subspaces
+}
+
+// emptySubspaces returns a slice of element indices for each subspace,
+// with a capacity equal to the subspace's size.
+func (m *Maddness[F]) emptySubspaces() [][]int {
+	subspaces := make([][]int, m.NumSubspaces)
+	for i := range subspaces {
+		begin, end := m.SubspaceBounds(i)
+		subspaces[i] = make([]int, 0, end-begin)
+	}
+	return subspaces
+}
+
+// correlations returns the variance of each element of the examples, and
+// the matrix of the Pearson correlation coefficients between each pair of
+// elements. The correlation involving an element with zero variance is zero.
+func correlations[F Float](examples Vectors[F]) ([]float64, [][]float64) {
+	size := len(examples[0])
+	mean := make([]float64, size)
+	for _, x := range examples {
+		for j, v := range x {
+			mean[j] += float64(v)
+		}
+	}
+	for j := range mean {
+		mean[j] /= float64(len(examples))
+	}
+
+	cov := make([][]float64, size)
+	for a := range cov {
+		cov[a] = make([]float64, size)
+	}
+	centered := make([]float64, size)
+	for _, x := range examples {
+		for j, v := range x {
+			centered[j] = float64(v) - mean[j]
+		}
+		for a, ca := range centered {
+			row := cov[a]
+			for b := a; b < size; b++ {
+				row[b] += ca * centered[b]
+			}
+		}
+	}
+
+	variance := make([]float64, size)
+	for a := range variance {
+		variance[a] = cov[a][a] / float64(len(examples))
+	}
+	for a := 0; a < size; a++ {
+		for b := a; b < size; b++ {
+			var c float64
+			if d := math.Sqrt(cov[a][a] * cov[b][b]); d > 0 {
+				c = cov[a][b] / d
+			}
+			cov[a][b], cov[b][a] = c, c
+		}
+	}
+	return variance, cov
+}
+
+// sampleExamples returns at most n examples, evenly spaced.
+func sampleExamples[F Float](examples Vectors[F], n int) Vectors[F] {
+	if len(examples) <= n {
+		return examples
+	}
+	sample := make(Vectors[F], n)
+	for i := range sample {
+		sample[i] = examples[i*len(examples)/n]
+	}
+	return sample
+}
+
+// permute returns the elements of v in the order of m.Permutation, or v
+// itself if the model has no permutation.
+func (m *Maddness[F]) permute(v Vector[F]) Vector[F] {
+	if m.Permutation == nil {
+		return v
+	}
+	p := make(Vector[F], len(m.Permutation))
+	for i, j := range m.Permutation {
+		p[i] = v[j]
+	}
+	return p
+}
+
+// permuteAll is like permute, for all the given vectors.
+func (m *Maddness[F]) permuteAll(vs Vectors[F]) Vectors[F] {
+	if m.Permutation == nil {
+		return vs
+	}
+	out := NewMatrix[F](len(vs), m.VectorSize)
+	for i, v := range vs {
+		row := out.Row(i)
+		for j, k := range m.Permutation {
+			row[j] = v[k]
+		}
+	}
+	return out.Vectors()
+}
+
+// unpermute restores the original order of the elements of v, reverting
+// permute, in place.
+func (m *Maddness[F]) unpermute(v Vector[F]) Vector[F] {
+	if m.Permutation == nil {
+		return v
+	}
+	p := v.Copy()
+	for i, j := range m.Permutation {
+		v[j] = p[i]
+	}
+	return v
+}
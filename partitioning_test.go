@@ -0,0 +1,94 @@
+// Copyright 2022, NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gomaddness
+
+import (
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestMaddness_learnPermutation(t *testing.T) {
+	t.Run("float32", testMaddnessLearnPermutation[float32])
+	t.Run("float64", testMaddnessLearnPermutation[float64])
+}
+
+func testMaddnessLearnPermutation[F Float](t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	examples := make(Vectors[F], 256)
+	for i := range examples {
+		a, b := r.NormFloat64(), r.NormFloat64()
+		// Elements 0 and 2 are strongly correlated, as 1 and 3 are;
+		// elements 0 and 1 have a larger variance than 2 and 3.
+		examples[i] = Vector[F]{
+			F(10 * a),
+			F(9 * b),
+			F(a + 0.1*r.NormFloat64()),
+			F(2*b + 0.1*r.NormFloat64()),
+		}
+	}
+
+	testCases := []struct {
+		partitioning Partitioning
+		expected     []int
+	}{
+		{PartitioningContiguous, nil},
+		{PartitioningVarianceBalanced, []int{0, 2, 1, 3}},
+		{PartitioningCorrelated, []int{0, 2, 1, 3}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.partitioning.String(), func(t *testing.T) {
+			m := &Maddness[F]{NumSubspaces: 2, VectorSize: 4, SubVectorSize: 2, Partitioning: tc.partitioning}
+			if p := m.learnPermutation(examples); !reflect.DeepEqual(p, tc.expected) {
+				t.Errorf("expected %v, actual %v", tc.expected, p)
+			}
+		})
+	}
+
+	t.Run("uneven subspaces", func(t *testing.T) {
+		m := &Maddness[F]{NumSubspaces: 3, VectorSize: 4, SubVectorSize: 2, SubspaceOffsets: []int{0, 2, 3, 4}}
+		for _, p := range []Partitioning{PartitioningVarianceBalanced, PartitioningCorrelated} {
+			m.Partitioning = p
+			if perm := m.learnPermutation(examples); !isPermutation(perm, 4) || perm == nil {
+				t.Errorf("%s: invalid permutation %v", p, perm)
+			}
+		}
+	})
+}
+
+func TestTrainMaddness_partitioning(t *testing.T) {
+	t.Run("float32", testTrainMaddnessPartitioning[float32])
+	t.Run("float64", testTrainMaddnessPartitioning[float64])
+}
+
+func testTrainMaddnessPartitioning[F Float](t *testing.T) {
+	examples, queryVectors := randomExamples[F](256, 12, 2)
+
+	for _, p := range []Partitioning{PartitioningVarianceBalanced, PartitioningCorrelated} {
+		m := TrainMaddness(examples, queryVectors, 3, WithPartitioning(p))
+		if m.Partitioning != p || !isPermutation(m.Permutation, m.VectorSize) || m.Permutation == nil {
+			t.Fatalf("%s: invalid permutation %v", p, m.Permutation)
+		}
+		if err := m.checkStructure(); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, x := range examples[:16] {
+			q := m.Quantize(x)
+			r := m.Reconstruct(q)
+			lutIndices := m.LookupTableIndices(q)
+			for j, qv := range queryVectors {
+				// Lookup tables and reconstructions must both honor the
+				// permutation, so that they are consistent.
+				expected := r.DotProduct(qv)
+				tolerance := float64(m.LookupTables[j].MaxError)*float64(m.NumSubspaces) + 1e-4
+				if actual := m.DotProduct(lutIndices, j); math.Abs(float64(actual-expected)) > tolerance {
+					t.Errorf("%s: expected %v, actual %v", p, expected, actual)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright 2022, NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gomaddness
+
+import (
+	"math/rand"
+)
+
+// PQEncoder is the Encoder of classic product quantization: each
+// sub-vector is assigned to the nearest centroid of the Codebook, learned
+// with k-means.
+type PQEncoder[F Float] struct {
+	Codebook Vectors[F] `json:"prototypes"`
+}
+
+// maxKMeansIterations is the maximum number of iterations of Lloyd's
+// algorithm performed by TrainPQEncoder.
+const maxKMeansIterations = 25
+
+// TrainPQEncoder learns numCodes centroids from the given examples, with
+// k-means (k-means++ initialization, followed by Lloyd's iterations),
+// returning a new PQEncoder.
+//
+// The number of codes must be in the range [1, 256]. The random number
+// generator rng is used for the initialization.
+func TrainPQEncoder[F Float](examples Vectors[F], numCodes int, rng *rand.Rand) *PQEncoder[F] {
+	if numCodes < 1 || numCodes > 256 {
+		panic("maddness: invalid number of codes (it must be in the range [1, 256])")
+	}
+	centroids := kMeansPlusPlus(examples, numCodes, rng)
+
+	assignments := make([]int, len(examples))
+	for i := range assignments {
+		assignments[i] = -1
+	}
+	for iter := 0; iter < maxKMeansIterations; iter++ {
+		changed := false
+		for i, x := range examples {
+			if c := nearestPrototype(centroids, x); c != assignments[i] {
+				assignments[i] = c
+				changed = true
+			}
+		}
+		if !changed {
+			break
+		}
+		updateCentroids(centroids, examples, assignments)
+	}
+	return &PQEncoder[F]{Codebook: centroids}
+}
+
+// Encode returns the index of the centroid nearest to v.
+func (e *PQEncoder[F]) Encode(v Vector[F]) uint8 {
+	return uint8(nearestPrototype(e.Codebook, v))
+}
+
+// Prototypes returns the centroids.
+func (e *PQEncoder[F]) Prototypes() Vectors[F] {
+	return e.Codebook
+}
+
+// NumCodes returns the number of centroids.
+func (e *PQEncoder[F]) NumCodes() int {
+	return len(e.Codebook)
+}
+
+// kMeansPlusPlus chooses k initial centroids among the examples, each one
+// with probability proportional to its squared distance from the nearest
+// centroid already chosen.
+func kMeansPlusPlus[F Float](examples Vectors[F], k int, rng *rand.Rand) Vectors[F] {
+	centroids := make(Vectors[F], 0, k)
+	centroids = append(centroids, examples[rng.Intn(len(examples))].Copy())
+
+	dists := make([]float64, len(examples))
+	for i := range dists {
+		dists[i] = -1
+	}
+	for len(centroids) < k {
+		last := centroids[len(centroids)-1]
+		var sum float64
+		for i, x := range examples {
+			d := float64(x.SquaredDistance(last))
+			if dists[i] < 0 || d < dists[i] {
+				dists[i] = d
+			}
+			sum += dists[i]
+		}
+		next := rng.Intn(len(examples))
+		if sum > 0 {
+			target := rng.Float64() * sum
+			for i, d := range dists {
+				if target -= d; target < 0 {
+					next = i
+					break
+				}
+			}
+		}
+		centroids = append(centroids, examples[next].Copy())
+	}
+	return centroids
+}
+
+// updateCentroids sets each centroid to the mean of the examples assigned
+// to it. A centroid without examples is moved to the example farthest
+// from its own centroid.
+func updateCentroids[F Float](centroids, examples Vectors[F], assignments []int) {
+	counts := make([]int, len(centroids))
+	for _, c := range centroids {
+		for j := range c {
+			c[j] = 0
+		}
+	}
+	for i, x := range examples {
+		c := assignments[i]
+		centroids[c].Add(x)
+		counts[c]++
+	}
+	for c, n := range counts {
+		if n > 0 {
+			centroids[c].DivScalar(F(n))
+		}
+	}
+	for c, n := range counts {
+		if n > 0 {
+			continue
+		}
+		farthest, farthestDist := 0, -1.0
+		for i, x := range examples {
+			if d := float64(x.SquaredDistance(centroids[assignments[i]])); d > farthestDist {
+				farthest, farthestDist = i, d
+			}
+		}
+		copy(centroids[c], examples[farthest])
+		assignments[farthest] = c
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2022, NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gomaddness
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestTrainPQEncoder(t *testing.T) {
+	t.Run("float32", testTrainPQEncoder[float32])
+	t.Run("float64", testTrainPQEncoder[float64])
+}
+
+func testTrainPQEncoder[F Float](t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	centers := Vectors[F]{{-10, -10}, {-10, 10}, {10, -10}, {10, 10}}
+	examples := make(Vectors[F], 200)
+	for i := range examples {
+		c := centers[i%len(centers)]
+		examples[i] = Vector[F]{c[0] + F(r.NormFloat64()), c[1] + F(r.NormFloat64())}
+	}
+
+	e := TrainPQEncoder(examples, 4, rand.New(rand.NewSource(42)))
+	if e.NumCodes() != 4 || len(e.Prototypes()) != 4 {
+		t.Fatalf("expected 4 codes, actual %d", e.NumCodes())
+	}
+	for _, c := range centers {
+		p := e.Prototypes()[e.Encode(c)]
+		if d := p.SquaredDistance(c); d > 1 {
+			t.Errorf("center %v: nearest centroid %v is too far", c, p)
+		}
+	}
+	for _, x := range examples {
+		code := e.Encode(x)
+		if expected := nearestPrototype(e.Codebook, x); int(code) != expected {
+			t.Errorf("expected code %d, actual %d", expected, code)
+		}
+	}
+
+	t.Run("invalid number of codes", func(t *testing.T) {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected panic")
+			}
+		}()
+		TrainPQEncoder(examples, 257, rand.New(rand.NewSource(1)))
+	})
+}
+
+func TestTrainMaddness_pq(t *testing.T) {
+	t.Run("float32", testTrainMaddnessPQ[float32])
+	t.Run("float64", testTrainMaddnessPQ[float64])
+}
+
+func testTrainMaddnessPQ[F Float](t *testing.T) {
+	examples, queryVectors := randomExamples[F](256, 12, 2)
+
+	m := TrainMaddness(examples, queryVectors, 3, WithEncoding(EncodingPQ), WithNumCodes(16))
+	if m.Encoding != EncodingPQ || len(m.Encoders) != 3 {
+		t.Fatalf("unexpected encoding %s with %d encoders", m.Encoding, len(m.Encoders))
+	}
+	if err := m.checkStructure(); err != nil {
+		t.Fatal(err)
+	}
+	for _, x := range examples[:16] {
+		q := m.Quantize(x)
+		r := m.Reconstruct(q)
+		lutIndices := m.LookupTableIndices(q)
+		for j, qv := range queryVectors {
+			expected := r.DotProduct(qv)
+			tolerance := float64(m.LookupTables[j].MaxError)*float64(m.NumSubspaces) + 1e-4
+			if actual := m.DotProduct(lutIndices, j); math.Abs(float64(actual-expected)) > tolerance {
+				t.Errorf("expected %v, actual %v", expected, actual)
+			}
+		}
+	}
+}
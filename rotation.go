@@ -0,0 +1,235 @@
+// Copyright 2022, NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gomaddness
+
+import (
+	"log"
+	"math"
+)
+
+// maxRotationExamples is the maximum amount of data examples used for
+// learning the rotation. Larger datasets are evenly sampled.
+const maxRotationExamples = 4096
+
+// maxJacobiSweeps is the maximum number of sweeps of the Jacobi SVD
+// algorithm used by orthogonalFactor.
+const maxJacobiSweeps = 30
+
+// learnRotation learns the rotation of the vectors that minimizes the
+// quantization error of the encoders, as in Optimized Product
+// Quantization (Ge et al., 2013), with the given number of iterations.
+//
+// Starting from the identity, each iteration trains the encoders on the
+// rotated examples, and then sets the rotation to the orthogonal matrix
+// that best maps the examples to their reconstructions (orthogonal
+// Procrustes problem). The encoders must be trained again afterwards.
+func (m *Maddness[F]) learnRotation(examples Vectors[F], numCodes, iterations int) {
+	log.Printf("maddness: learning rotation with %d iterations...", iterations)
+
+	examples = sampleExamples(examples, maxRotationExamples)
+	m.Rotation = nil
+	for iter := 0; iter < iterations; iter++ {
+		m.trainAllEncoders(m.permuteAll(m.rotateAll(examples)), numCodes)
+
+		// cross[p] is the p-th column of the sum of the outer products of
+		// each reconstruction by its example.
+		cross := make([][]float64, m.VectorSize)
+		for p := range cross {
+			cross[p] = make([]float64, m.VectorSize)
+		}
+		for _, x := range examples {
+			y := m.reconstructRotated(m.Quantize(x))
+			for p, xp := range x {
+				col := cross[p]
+				for i, yi := range y {
+					col[i] += float64(xp) * float64(yi)
+				}
+			}
+		}
+
+		r := orthogonalFactor(cross)
+		m.Rotation = NewMatrix[F](m.VectorSize, m.VectorSize).Vectors()
+		for i, row := range m.Rotation {
+			for j := range row {
+				row[j] = F(r[i][j])
+			}
+		}
+	}
+
+	log.Print("maddness: rotation learned.")
+}
+
+// orthogonalFactor returns the orthogonal matrix U V^T, given the
+// columns of a square matrix with singular value decomposition U S V^T.
+// It is the orthogonal matrix closest to the given one.
+//
+// The decomposition is computed with the one-sided Jacobi algorithm,
+// which modifies the given columns. The singular vectors of null
+// singular values are completed with Gram-Schmidt orthogonalization.
+func orthogonalFactor(cols [][]float64) [][]float64 {
+	n := len(cols)
+	v := make([][]float64, n)
+	for k := range v {
+		v[k] = make([]float64, n)
+		v[k][k] = 1
+	}
+
+	for sweep := 0; sweep < maxJacobiSweeps; sweep++ {
+		rotated := false
+		for p := 0; p < n; p++ {
+			for q := p + 1; q < n; q++ {
+				var alpha, beta, gamma float64
+				for i := range cols[p] {
+					alpha += cols[p][i] * cols[p][i]
+					beta += cols[q][i] * cols[q][i]
+					gamma += cols[p][i] * cols[q][i]
+				}
+				if gamma == 0 || math.Abs(gamma) <= 1e-15*math.Sqrt(alpha*beta) {
+					continue
+				}
+				rotated = true
+				zeta := (beta - alpha) / (2 * gamma)
+				t := math.Copysign(1, zeta) / (math.Abs(zeta) + math.Sqrt(1+zeta*zeta))
+				c := 1 / math.Sqrt(1+t*t)
+				s := c * t
+				jacobiRotate(cols[p], cols[q], c, s)
+				jacobiRotate(v[p], v[q], c, s)
+			}
+		}
+		if !rotated {
+			break
+		}
+	}
+
+	// The columns are now U S: normalize them, keeping track of the null
+	// ones, which are replaced afterwards.
+	maxNorm := 0.0
+	norms := make([]float64, n)
+	for k, col := range cols {
+		norms[k] = math.Sqrt(dot(col, col))
+		maxNorm = math.Max(maxNorm, norms[k])
+	}
+	var null []int
+	for k, col := range cols {
+		if norms[k] <= 1e-12*maxNorm || norms[k] == 0 {
+			null = append(null, k)
+			continue
+		}
+		for i := range col {
+			col[i] /= norms[k]
+		}
+	}
+	for _, k := range null {
+		completeBasis(cols, k, null)
+	}
+
+	r := make([][]float64, n)
+	for i := range r {
+		r[i] = make([]float64, n)
+		for j := range r[i] {
+			var sum float64
+			for k := 0; k < n; k++ {
+				sum += cols[k][i] * v[k][j]
+			}
+			r[i][j] = sum
+		}
+	}
+	return r
+}
+
+// jacobiRotate applies a plane rotation to the vectors a and b.
+func jacobiRotate(a, b []float64, c, s float64) {
+	for i, x := range a {
+		y := b[i]
+		a[i] = c*x - s*y
+		b[i] = s*x + c*y
+	}
+}
+
+// completeBasis sets cols[k] to a unit vector orthogonal to all the other
+// columns, except the null ones which are not set yet, that is, those in
+// null after k.
+func completeBasis(cols [][]float64, k int, null []int) {
+	pending := make(map[int]bool)
+	for _, j := range null {
+		if j > k {
+			pending[j] = true
+		}
+	}
+	n := len(cols)
+	best := make([]float64, n)
+	bestNorm := -1.0
+	candidate := make([]float64, n)
+	for e := 0; e < n; e++ {
+		for i := range candidate {
+			candidate[i] = 0
+		}
+		candidate[e] = 1
+		for j, col := range cols {
+			if j == k || pending[j] {
+				continue
+			}
+			d := dot(candidate, col)
+			for i, x := range col {
+				candidate[i] -= d * x
+			}
+		}
+		if norm := math.Sqrt(dot(candidate, candidate)); norm > bestNorm {
+			bestNorm = norm
+			copy(best, candidate)
+		}
+	}
+	for i, x := range best {
+		cols[k][i] = x / bestNorm
+	}
+}
+
+func dot(a, b []float64) float64 {
+	var sum float64
+	for i, x := range a {
+		sum += x * b[i]
+	}
+	return sum
+}
+
+// rotate returns the product of m.Rotation by v, or v itself if the model
+// has no rotation.
+func (m *Maddness[F]) rotate(v Vector[F]) Vector[F] {
+	if m.Rotation == nil {
+		return v
+	}
+	r := make(Vector[F], len(m.Rotation))
+	for i, row := range m.Rotation {
+		r[i] = row.DotProduct(v)
+	}
+	return r
+}
+
+// rotateAll is like rotate, for all the given vectors.
+func (m *Maddness[F]) rotateAll(vs Vectors[F]) Vectors[F] {
+	if m.Rotation == nil {
+		return vs
+	}
+	out := make(Vectors[F], len(vs))
+	for i, v := range vs {
+		out[i] = m.rotate(v)
+	}
+	return out
+}
+
+// unrotate returns the product of the transpose of m.Rotation by v,
+// reverting rotate, or v itself if the model has no rotation.
+func (m *Maddness[F]) unrotate(v Vector[F]) Vector[F] {
+	if m.Rotation == nil {
+		return v
+	}
+	r := make(Vector[F], len(v))
+	for i, row := range m.Rotation {
+		for j, x := range row {
+			r[j] += x * v[i]
+		}
+	}
+	return r
+}
@@ -0,0 +1,132 @@
+// Copyright 2022, NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gomaddness
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestOrthogonalFactor(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	random := make([][]float64, 6)
+	for i := range random {
+		random[i] = make([]float64, 6)
+		for j := range random[i] {
+			random[i][j] = r.NormFloat64()
+		}
+	}
+	rankOne := make([][]float64, 4)
+	for i := range rankOne {
+		rankOne[i] = []float64{1, 2, 3, 4}
+	}
+
+	for name, cols := range map[string][][]float64{
+		"random":   random,
+		"rank one": rankOne,
+		"zero":     {{0, 0, 0}, {0, 0, 0}, {0, 0, 0}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			q := orthogonalFactor(cols)
+			assertOrthogonal(t, q, 1e-9)
+		})
+	}
+
+	t.Run("orthogonal", func(t *testing.T) {
+		// A permutation with a reflection is its own orthogonal factor.
+		expected := [][]float64{{0, 1, 0}, {-1, 0, 0}, {0, 0, 1}}
+		cols := make([][]float64, 3)
+		for k := range cols {
+			cols[k] = []float64{expected[0][k], expected[1][k], expected[2][k]}
+		}
+		q := orthogonalFactor(cols)
+		for i := range q {
+			for j := range q[i] {
+				if math.Abs(q[i][j]-expected[i][j]) > 1e-9 {
+					t.Fatalf("expected %v, actual %v", expected, q)
+				}
+			}
+		}
+	})
+}
+
+func assertOrthogonal(t *testing.T, q [][]float64, tolerance float64) {
+	t.Helper()
+	for i := range q {
+		for j := range q {
+			expected := 0.0
+			if i == j {
+				expected = 1
+			}
+			if d := dot(q[i], q[j]); math.Abs(d-expected) > tolerance {
+				t.Fatalf("matrix is not orthogonal: rows %d and %d have dot product %v", i, j, d)
+			}
+		}
+	}
+}
+
+func TestTrainMaddness_rotation(t *testing.T) {
+	t.Run("float32", testTrainMaddnessRotation[float32])
+	t.Run("float64", testTrainMaddnessRotation[float64])
+}
+
+func testTrainMaddnessRotation[F Float](t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	examples := make(Vectors[F], 512)
+	for i := range examples {
+		// The elements of the two subspaces are strongly correlated.
+		a, b := r.NormFloat64(), r.NormFloat64()
+		examples[i] = Vector[F]{
+			F(a + 0.05*r.NormFloat64()),
+			F(b + 0.05*r.NormFloat64()),
+			F(a + 0.05*r.NormFloat64()),
+			F(b + 0.05*r.NormFloat64()),
+		}
+	}
+	queryVectors := examples[:4]
+
+	squaredError := func(m *Maddness[F]) (sum float64) {
+		for _, x := range examples {
+			sum += float64(m.Reconstruct(m.Quantize(x)).SquaredDistance(x))
+		}
+		return sum
+	}
+
+	opts := []Option{WithEncoding(EncodingPQ), WithNumCodes(4)}
+	plain := TrainMaddness(examples, queryVectors, 2, opts...)
+	m := TrainMaddness(examples, queryVectors, 2, append(opts, WithRotation(5))...)
+
+	if m.Rotation == nil {
+		t.Fatal("expected a rotation")
+	}
+	rotation := make([][]float64, len(m.Rotation))
+	for i, row := range m.Rotation {
+		rotation[i] = make([]float64, len(row))
+		for j, x := range row {
+			rotation[i][j] = float64(x)
+		}
+	}
+	assertOrthogonal(t, rotation, 1e-5)
+
+	if plainError, rotatedError := squaredError(plain), squaredError(m); rotatedError >= plainError {
+		t.Errorf("expected lower error with rotation: %v, without: %v", rotatedError, plainError)
+	}
+
+	for _, x := range examples[:16] {
+		q := m.Quantize(x)
+		rec := m.Reconstruct(q)
+		lutIndices := m.LookupTableIndices(q)
+		for j, qv := range queryVectors {
+			// The rotation is folded into the lookup tables, preserving
+			// the dot products with the reconstructions.
+			expected := rec.DotProduct(qv)
+			tolerance := float64(m.LookupTables[j].MaxError)*float64(m.NumSubspaces) + 1e-3
+			if actual := m.DotProduct(lutIndices, j); math.Abs(float64(actual-expected)) > tolerance {
+				t.Errorf("expected %v, actual %v", expected, actual)
+			}
+		}
+	}
+}
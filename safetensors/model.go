@@ -0,0 +1,474 @@
+// Copyright 2022, NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package safetensors
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/nlpodyssey/gomaddness"
+)
+
+// modelTensors returns the tensors representing the model m.
+func modelTensors[F gomaddness.Float](m *gomaddness.Maddness[F]) ([]tensor, error) {
+	if len(m.Encoders) == 0 {
+		return nil, errors.New("safetensors: invalid model without encoders")
+	}
+	numProtos := m.Encoders[0].NumCodes()
+	numLevels := 0
+	if h, ok := m.Encoders[0].(*gomaddness.Hash[F]); ok {
+		numLevels = len(h.TreeLevels)
+	}
+
+	var splitIndices, treeNodes []byte
+	var splitThresholds, treeThresholds, prototypes []F
+	for _, e := range m.Encoders {
+		switch e := e.(type) {
+		case *gomaddness.Hash[F]:
+			for _, level := range e.TreeLevels {
+				splitIndices = appendUint64(splitIndices, uint64(level.SplitIndex))
+				splitThresholds = append(splitThresholds, level.SplitThresholds...)
+			}
+		case *gomaddness.UnbalancedTree[F]:
+			for _, node := range e.Nodes {
+				treeNodes = appendUint64(treeNodes, uint64(node.SplitIndex))
+				treeNodes = appendUint64(treeNodes, uint64(int64(node.Children[0])))
+				treeNodes = appendUint64(treeNodes, uint64(int64(node.Children[1])))
+				treeThresholds = append(treeThresholds, node.SplitThreshold)
+			}
+		}
+		for _, p := range e.Prototypes() {
+			prototypes = append(prototypes, p...)
+			for j := len(p); j < m.SubVectorSize; j++ {
+				prototypes = append(prototypes, 0)
+			}
+		}
+	}
+
+	fdt := floatDType[F]()
+	var tensors []tensor
+	if m.Encoding == gomaddness.EncodingHashTree {
+		tensors = append(tensors,
+			tensor{"split_indices", "I64", []int{m.NumSubspaces, numLevels}, splitIndices},
+			tensor{"split_thresholds", fdt, []int{m.NumSubspaces, numProtos - 1}, encodeFloats(splitThresholds)},
+		)
+	}
+	if m.Encoding == gomaddness.EncodingUnbalancedTree {
+		tensors = append(tensors,
+			tensor{"tree_nodes", "I64", []int{m.NumSubspaces, numProtos - 1, 3}, treeNodes},
+			tensor{"tree_thresholds", fdt, []int{m.NumSubspaces, numProtos - 1}, encodeFloats(treeThresholds)},
+		)
+	}
+	tensors = append(tensors, tensor{"prototypes", fdt, []int{m.NumSubspaces, numProtos, m.SubVectorSize}, encodeFloats(prototypes)})
+	if m.SubspaceOffsets != nil {
+		tensors = append(tensors, intTensor("subspace_offsets", m.SubspaceOffsets))
+	}
+	if m.Permutation != nil {
+		tensors = append(tensors, intTensor("permutation", m.Permutation))
+	}
+	if m.Rotation != nil {
+		var rotation []F
+		for _, row := range m.Rotation {
+			rotation = append(rotation, row...)
+		}
+		tensors = append(tensors, tensor{"rotation", floatDType[F](), []int{m.VectorSize, m.VectorSize}, encodeFloats(rotation)})
+	}
+	if m.PrototypeSquaredNorms != nil {
+		if len(m.PrototypeSquaredNorms) != m.NumSubspaces*numProtos {
+			return nil, errors.New("safetensors: invalid number of prototype norms")
+		}
+		tensors = append(tensors, tensor{"prototype_squared_norms", fdt, []int{m.NumSubspaces, numProtos}, encodeFloats(m.PrototypeSquaredNorms)})
+	}
+
+	q := len(m.LookupTables)
+	var lutData []byte
+	var bias, scale, maxError, queryNorms, offsets []F
+	var metrics []byte
+	hasOffsets := q > 0 && m.LookupTables[0].Offsets != nil
+	hasMetrics := false
+	for _, lut := range m.LookupTables {
+		if lut.Precision != m.Precision || (lut.Offsets != nil) != hasOffsets {
+			return nil, errors.New("safetensors: lookup tables with different precision or scaling")
+		}
+		lutData = append(lutData, lut.Data...)
+		bias = append(bias, lut.Bias)
+		scale = append(scale, lut.Scale)
+		maxError = append(maxError, lut.MaxError)
+		queryNorms = append(queryNorms, lut.QueryNorm)
+		offsets = append(offsets, lut.Offsets...)
+		metrics = append(metrics, uint8(lut.Metric))
+		hasMetrics = hasMetrics || lut.Metric != gomaddness.MetricDotProduct
+	}
+	lutDType, ok := precisionDTypes[m.Precision]
+	if !ok {
+		return nil, errors.New("safetensors: unsupported lookup-table precision")
+	}
+	tensors = append(tensors,
+		tensor{"luts", lutDType, []int{q, m.NumSubspaces, numProtos}, lutData},
+		tensor{"lut_bias", fdt, []int{q}, encodeFloats(bias)},
+		tensor{"lut_scale", fdt, []int{q}, encodeFloats(scale)},
+		tensor{"lut_max_error", fdt, []int{q}, encodeFloats(maxError)},
+		tensor{"lut_query_norms", fdt, []int{q}, encodeFloats(queryNorms)},
+	)
+	if hasOffsets {
+		tensors = append(tensors, tensor{"lut_offsets", fdt, []int{q, m.NumSubspaces}, encodeFloats(offsets)})
+	}
+	if hasMetrics {
+		tensors = append(tensors, tensor{"lut_metrics", "U8", []int{q}, metrics})
+	}
+	return tensors, nil
+}
+
+// precisionDTypes maps lookup-table precisions to safetensors data types.
+var precisionDTypes = map[gomaddness.Precision]string{
+	gomaddness.PrecisionUint8:   "U8",
+	gomaddness.PrecisionUint16:  "U16",
+	gomaddness.PrecisionFloat16: "F16",
+	gomaddness.PrecisionFloat32: "F32",
+}
+
+// decode imports a model from the content of a safetensors file.
+func decode[F gomaddness.Float](data []byte) (*gomaddness.Maddness[F], error) {
+	tensors, metadata, err := readTensors(data)
+	if err != nil {
+		return nil, err
+	}
+	if metadata["format"] != formatName {
+		return nil, errors.New("safetensors: missing or invalid format metadata")
+	}
+
+	m, err := decodeMetadata[F](metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &decoder{tensors: tensors}
+	s := m.NumSubspaces
+	if _, ok := tensors["subspace_offsets"]; ok {
+		m.SubspaceOffsets = decodeInts(d.tensor("subspace_offsets", []string{"I64"}, s+1).data)
+	}
+	if _, ok := tensors["permutation"]; ok {
+		m.Permutation = decodeInts(d.tensor("permutation", []string{"I64"}, m.VectorSize).data)
+	}
+	if _, ok := tensors["rotation"]; ok {
+		rotation := decodeFloats[F](d.tensor("rotation", []string{floatDType[F]()}, m.VectorSize, m.VectorSize).data)
+		if d.err == nil {
+			m.Rotation = gomaddness.NewMatrixFromSlice(rotation, m.VectorSize, m.VectorSize, m.VectorSize).Vectors()
+		}
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	fdt := []string{floatDType[F]()}
+	var splitIndices, splitThresholds, treeNodes, prototypes tensor
+	var numLevels, numProtos int
+	if m.Encoding == gomaddness.EncodingHashTree {
+		splitIndices = d.tensor("split_indices", []string{"I64"}, s, -1)
+		numLevels = d.dim(splitIndices, 1)
+		if numLevels > 8 {
+			return nil, errors.New("safetensors: too many hashing tree levels")
+		}
+		numProtos = 1 << numLevels
+		splitThresholds = d.tensor("split_thresholds", fdt, s, numProtos-1)
+		prototypes = d.tensor("prototypes", fdt, s, numProtos, m.SubVectorSize)
+	} else {
+		prototypes = d.tensor("prototypes", fdt, s, -1, m.SubVectorSize)
+		numProtos = d.dim(prototypes, 1)
+		if d.err == nil && (numProtos < 1 || numProtos > 256 ||
+			(m.Encoding == gomaddness.EncodingBolt && numProtos != gomaddness.BoltNumCodes)) {
+			return nil, fmt.Errorf("safetensors: invalid number of prototypes %d", numProtos)
+		}
+		if m.Encoding == gomaddness.EncodingUnbalancedTree {
+			treeNodes = d.tensor("tree_nodes", []string{"I64"}, s, numProtos-1, 3)
+			splitThresholds = d.tensor("tree_thresholds", fdt, s, numProtos-1)
+		}
+	}
+	if _, ok := tensors["prototype_squared_norms"]; ok {
+		m.PrototypeSquaredNorms = decodeFloats[F](d.tensor("prototype_squared_norms", fdt, s, numProtos).data)
+	}
+	luts := d.tensor("luts", []string{precisionDTypes[m.Precision]}, -1, s, numProtos)
+	q := d.dim(luts, 0)
+	bias := d.tensor("lut_bias", fdt, q)
+	scale := d.tensor("lut_scale", fdt, q)
+	maxError := d.tensor("lut_max_error", fdt, q)
+	var offsets []F
+	if _, ok := tensors["lut_offsets"]; ok {
+		offsets = decodeFloats[F](d.tensor("lut_offsets", fdt, q, s).data)
+	}
+	var queryNorms []F
+	if _, ok := tensors["lut_query_norms"]; ok {
+		queryNorms = decodeFloats[F](d.tensor("lut_query_norms", fdt, q).data)
+	}
+	var metrics []byte
+	if _, ok := tensors["lut_metrics"]; ok {
+		metrics = d.tensor("lut_metrics", []string{"U8"}, q).data
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	thresholds := decodeFloats[F](splitThresholds.data)
+	protos := decodeFloats[F](prototypes.data)
+	m.Encoders = make([]gomaddness.Encoder[F], s)
+	for i := range m.Encoders {
+		begin, end := m.SubspaceBounds(i)
+		if end-begin <= 0 || end-begin > m.SubVectorSize {
+			// The remaining inconsistencies are reported by Validate.
+			return nil, errors.New("safetensors: invalid subspace offsets")
+		}
+		codebook := make(gomaddness.Vectors[F], numProtos)
+		for j := range codebook {
+			offset := (i*numProtos + j) * m.SubVectorSize
+			codebook[j] = protos[offset : offset+end-begin]
+		}
+		switch m.Encoding {
+		case gomaddness.EncodingPQ:
+			m.Encoders[i] = &gomaddness.PQEncoder[F]{Codebook: codebook}
+			continue
+		case gomaddness.EncodingBolt:
+			m.Encoders[i] = &gomaddness.BoltEncoder[F]{Codebook: codebook}
+			continue
+		case gomaddness.EncodingUnbalancedTree:
+			t := &gomaddness.UnbalancedTree[F]{
+				Nodes:    make([]gomaddness.TreeNode[F], numProtos-1),
+				Codebook: codebook,
+			}
+			values := decodeInts(treeNodes.data[i*(numProtos-1)*24 : (i+1)*(numProtos-1)*24])
+			for j := range t.Nodes {
+				t.Nodes[j] = gomaddness.TreeNode[F]{
+					SplitIndex:     values[j*3],
+					SplitThreshold: thresholds[i*(numProtos-1)+j],
+					Children:       [2]int{values[j*3+1], values[j*3+2]},
+				}
+			}
+			m.Encoders[i] = t
+			continue
+		}
+		h := &gomaddness.Hash[F]{
+			TreeLevels: make([]*gomaddness.HashingTreeLevel[F], numLevels),
+			Codebook:   codebook,
+		}
+		for l := range h.TreeLevels {
+			h.TreeLevels[l] = &gomaddness.HashingTreeLevel[F]{
+				SplitIndex:      int(int64(binary.LittleEndian.Uint64(splitIndices.data[(i*numLevels+l)*8:]))),
+				SplitThresholds: thresholds[i*(numProtos-1)+(1<<l)-1 : i*(numProtos-1)+(2<<l)-1],
+			}
+		}
+		m.Encoders[i] = h
+	}
+
+	biasValues, scaleValues, maxErrorValues := decodeFloats[F](bias.data), decodeFloats[F](scale.data), decodeFloats[F](maxError.data)
+	lutSize := len(luts.data) / maxInt(q, 1)
+	m.LookupTables = make([]*gomaddness.LookupTable[F], q)
+	for i := range m.LookupTables {
+		lut := &gomaddness.LookupTable[F]{
+			Bias:      biasValues[i],
+			Scale:     scaleValues[i],
+			MaxError:  maxErrorValues[i],
+			Precision: m.Precision,
+			Data:      luts.data[i*lutSize : (i+1)*lutSize],
+		}
+		if offsets != nil {
+			lut.Offsets = offsets[i*s : (i+1)*s]
+		}
+		if queryNorms != nil {
+			lut.QueryNorm = queryNorms[i]
+		}
+		if metrics != nil {
+			lut.Metric = gomaddness.Metric(metrics[i])
+		}
+		m.LookupTables[i] = lut
+	}
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func decodeMetadata[F gomaddness.Float](metadata map[string]string) (*gomaddness.Maddness[F], error) {
+	m := &gomaddness.Maddness[F]{}
+	var err error
+	intValue := func(key string) int {
+		v, e := strconv.Atoi(metadata[key])
+		if e != nil && err == nil {
+			err = fmt.Errorf("safetensors: invalid %s metadata", key)
+		}
+		return v
+	}
+	m.NumSubspaces = intValue("num_subspaces")
+	m.VectorSize = intValue("vector_size")
+	m.SubVectorSize = intValue("sub_vector_size")
+	if err != nil {
+		return nil, err
+	}
+	if m.NumSubspaces <= 0 || m.SubVectorSize <= 0 || m.NumSubspaces > m.VectorSize {
+		return nil, errors.New("safetensors: inconsistent vector size metadata")
+	}
+	if m.RandomSeed, err = strconv.ParseInt(metadata["random_seed"], 10, 64); err != nil {
+		return nil, errors.New("safetensors: invalid random_seed metadata")
+	}
+
+	if m.Aggregation, err = parseEnum[gomaddness.Aggregation](metadata, "aggregation"); err != nil {
+		return nil, err
+	}
+	if m.Scaling, err = parseEnum[gomaddness.Scaling](metadata, "scaling"); err != nil {
+		return nil, err
+	}
+	if m.Precision, err = parseEnum[gomaddness.Precision](metadata, "precision"); err != nil {
+		return nil, err
+	}
+	if m.Rounding, err = parseEnum[gomaddness.Rounding](metadata, "rounding"); err != nil {
+		return nil, err
+	}
+	// The partitioning is missing from files written before its
+	// introduction, meaning contiguous.
+	if _, ok := metadata["partitioning"]; ok {
+		if m.Partitioning, err = parseEnum[gomaddness.Partitioning](metadata, "partitioning"); err != nil {
+			return nil, err
+		}
+	}
+	// The same applies to the encoding, meaning hashing trees, and to the
+	// assignment, meaning by encoder.
+	if _, ok := metadata["encoding"]; ok {
+		if m.Encoding, err = parseEnum[gomaddness.Encoding](metadata, "encoding"); err != nil {
+			return nil, err
+		}
+	}
+	if _, ok := metadata["assignment"]; ok {
+		if m.Assignment, err = parseEnum[gomaddness.Assignment](metadata, "assignment"); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// parseEnum returns the value of type E whose name, as returned by
+// String, is the metadata value with the given key.
+func parseEnum[E interface {
+	~uint8
+	String() string
+}](metadata map[string]string, key string) (E, error) {
+	name := metadata[key]
+	for i := 0; i <= math.MaxUint8; i++ {
+		if e := E(i); e.String() == name {
+			return e, nil
+		}
+	}
+	return 0, fmt.Errorf("safetensors: invalid %s metadata %q", key, name)
+}
+
+// decoder looks up tensors, validating their data type and shape,
+// and keeping track of the first error encountered.
+type decoder struct {
+	tensors map[string]tensor
+	err     error
+}
+
+// tensor returns the tensor with the given name, reporting an error if
+// it is missing, or if its data type or shape are not the expected ones.
+// An expected dimension of -1 matches any value.
+func (d *decoder) tensor(name string, dtypes []string, shape ...int) tensor {
+	if d.err != nil {
+		return tensor{}
+	}
+	t, ok := d.tensors[name]
+	if !ok {
+		d.err = fmt.Errorf("safetensors: missing tensor %q", name)
+		return tensor{}
+	}
+	if !contains(dtypes, t.dtype) {
+		d.err = fmt.Errorf("safetensors: tensor %q has dtype %s, expected %v", name, t.dtype, dtypes)
+		return tensor{}
+	}
+	valid := len(t.shape) == len(shape)
+	for i := 0; valid && i < len(shape); i++ {
+		valid = shape[i] == -1 || shape[i] == t.shape[i]
+	}
+	if !valid {
+		d.err = fmt.Errorf("safetensors: tensor %q has shape %v, expected %v", name, t.shape, shape)
+		return tensor{}
+	}
+	return t
+}
+
+// dim returns the i-th dimension of t, or 0 after an error.
+func (d *decoder) dim(t tensor, i int) int {
+	if d.err != nil {
+		return 0
+	}
+	return t.shape[i]
+}
+
+func encodeFloats[F gomaddness.Float](vs []F) []byte {
+	if floatDType[F]() == "F32" {
+		b := make([]byte, len(vs)*4)
+		for i, v := range vs {
+			binary.LittleEndian.PutUint32(b[i*4:], math.Float32bits(float32(v)))
+		}
+		return b
+	}
+	b := make([]byte, 0, len(vs)*8)
+	for _, v := range vs {
+		b = appendUint64(b, math.Float64bits(float64(v)))
+	}
+	return b
+}
+
+// intTensor returns a one-dimensional I64 tensor with the given values.
+func intTensor(name string, vs []int) tensor {
+	data := make([]byte, 0, len(vs)*8)
+	for _, v := range vs {
+		data = appendUint64(data, uint64(v))
+	}
+	return tensor{name, "I64", []int{len(vs)}, data}
+}
+
+func decodeInts(b []byte) []int {
+	vs := make([]int, len(b)/8)
+	for i := range vs {
+		vs[i] = int(int64(binary.LittleEndian.Uint64(b[i*8:])))
+	}
+	return vs
+}
+
+func appendUint64(b []byte, v uint64) []byte {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+func decodeFloats[F gomaddness.Float](b []byte) []F {
+	if floatDType[F]() == "F32" {
+		vs := make([]F, len(b)/4)
+		for i := range vs {
+			vs[i] = F(math.Float32frombits(binary.LittleEndian.Uint32(b[i*4:])))
+		}
+		return vs
+	}
+	vs := make([]F, len(b)/8)
+	for i := range vs {
+		vs[i] = F(math.Float64frombits(binary.LittleEndian.Uint64(b[i*8:])))
+	}
+	return vs
+}
+
+func contains(ss []string, s string) bool {
+	for _, x := range ss {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,248 @@
+// Copyright 2022, NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package safetensors exports trained gomaddness models into safetensors
+// files, and imports them back.
+//
+// A model is stored as the following tensors, where S is the number of
+// subspaces, L the number of levels of each hashing tree, P the number
+// of prototypes of each subspace, D the size of the largest subspace, and
+// Q the number of lookup tables (query vectors):
+//
+//   - "split_indices" (S, L), I64: only present with hashing trees;
+//   - "split_thresholds" (S, P-1), float: the split thresholds of all
+//     tree levels, concatenated level by level, only present with
+//     hashing trees;
+//   - "prototypes" (S, P, D), float: the prototypes of smaller subspaces
+//     are padded with zeros;
+//   - "subspace_offsets" (S+1), I64: the boundaries of the subspaces,
+//     only present if they have different sizes;
+//   - "permutation" (V), I64: the order in which the elements of the input
+//     vectors, of size V, are assigned to the subspaces, only present if
+//     the partitioning is not contiguous;
+//   - "rotation" (V, V), float: the rotation matrix, by which the input
+//     vectors are multiplied before the permutation, only present if
+//     learned;
+//   - "prototype_squared_norms" (S, P), float: the squared norms of the
+//     prototypes, optional;
+//   - "luts" (Q, S, P): the lookup-table data, whose data type depends
+//     on the tables' precision (U8, U16, F16 or F32);
+//   - "lut_bias", "lut_scale" and "lut_max_error" (Q), float;
+//   - "lut_offsets" (Q, S), float: only present with per-subspace scaling;
+//   - "lut_query_norms" (Q), float: the norm of each lookup table's query
+//     vector, optional when reading;
+//   - "lut_metrics" (Q), U8: the metric of each lookup table (0 for dot
+//     product, 1 for squared Euclidean distance), only present if any
+//     table is not a dot-product table.
+//
+// Float tensors are F32 or F64, according to the model's floating point
+// type. The remaining model parameters, such as "num_subspaces",
+// "vector_size" and "sub_vector_size", are stored as metadata.
+package safetensors
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"unsafe"
+
+	"github.com/nlpodyssey/gomaddness"
+)
+
+// formatName is the value of the "format" metadata entry.
+const formatName = "gomaddness"
+
+// tensorInfo is the header entry of a tensor.
+type tensorInfo struct {
+	DType       string   `json:"dtype"`
+	Shape       []int    `json:"shape"`
+	DataOffsets [2]int64 `json:"data_offsets"`
+}
+
+// tensor is a named tensor, with its data already encoded.
+type tensor struct {
+	name  string
+	dtype string
+	shape []int
+	data  []byte
+}
+
+// Write exports the model m to w, in safetensors format.
+func Write[F gomaddness.Float](w io.Writer, m *gomaddness.Maddness[F]) error {
+	tensors, err := modelTensors(m)
+	if err != nil {
+		return err
+	}
+	metadata := map[string]string{
+		"format":          formatName,
+		"num_subspaces":   strconv.Itoa(m.NumSubspaces),
+		"vector_size":     strconv.Itoa(m.VectorSize),
+		"sub_vector_size": strconv.Itoa(m.SubVectorSize),
+		"aggregation":     m.Aggregation.String(),
+		"scaling":         m.Scaling.String(),
+		"precision":       m.Precision.String(),
+		"rounding":        m.Rounding.String(),
+		"partitioning":    m.Partitioning.String(),
+		"encoding":        m.Encoding.String(),
+		"assignment":      m.Assignment.String(),
+		"random_seed":     strconv.FormatInt(m.RandomSeed, 10),
+	}
+	return writeTensors(w, tensors, metadata)
+}
+
+// Save exports the model m to a new file at the given path, or truncates
+// an existing one.
+func Save[F gomaddness.Float](path string, m *gomaddness.Maddness[F]) (err error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if e := f.Close(); e != nil && err == nil {
+			err = e
+		}
+	}()
+	return Write(f, m)
+}
+
+// Read imports a model from r, as written by Write.
+//
+// The data types and shapes of all tensors are validated, and an error
+// is returned if they are not consistent with the metadata.
+func Read[F gomaddness.Float](r io.Reader) (*gomaddness.Maddness[F], error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return decode[F](data)
+}
+
+// Load imports a model from the file at the given path, as written by Save.
+func Load[F gomaddness.Float](path string) (*gomaddness.Maddness[F], error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return decode[F](data)
+}
+
+func writeTensors(w io.Writer, tensors []tensor, metadata map[string]string) error {
+	header := make(map[string]any, len(tensors)+1)
+	header["__metadata__"] = metadata
+	var offset int64
+	for _, t := range tensors {
+		header[t.name] = tensorInfo{
+			DType:       t.dtype,
+			Shape:       t.shape,
+			DataOffsets: [2]int64{offset, offset + int64(len(t.data))},
+		}
+		offset += int64(len(t.data))
+	}
+
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return err
+	}
+	// The header is padded with spaces, so that the data is aligned
+	// to 8 bytes.
+	if pad := len(headerJSON) % 8; pad != 0 {
+		headerJSON = append(headerJSON, bytes.Repeat([]byte{' '}, 8-pad)...)
+	}
+
+	var size [8]byte
+	binary.LittleEndian.PutUint64(size[:], uint64(len(headerJSON)))
+	if _, err := w.Write(size[:]); err != nil {
+		return err
+	}
+	if _, err := w.Write(headerJSON); err != nil {
+		return err
+	}
+	for _, t := range tensors {
+		if _, err := w.Write(t.data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readTensors parses a safetensors file, returning its tensors by name,
+// and its metadata.
+func readTensors(data []byte) (map[string]tensor, map[string]string, error) {
+	if len(data) < 8 {
+		return nil, nil, errors.New("safetensors: invalid file")
+	}
+	headerSize := binary.LittleEndian.Uint64(data)
+	if headerSize > uint64(len(data)-8) {
+		return nil, nil, errors.New("safetensors: invalid header size")
+	}
+	body := data[8+headerSize:]
+
+	var header map[string]json.RawMessage
+	if err := json.Unmarshal(data[8:8+headerSize], &header); err != nil {
+		return nil, nil, fmt.Errorf("safetensors: invalid header: %w", err)
+	}
+
+	var metadata map[string]string
+	tensors := make(map[string]tensor, len(header))
+	for name, raw := range header {
+		if name == "__metadata__" {
+			if err := json.Unmarshal(raw, &metadata); err != nil {
+				return nil, nil, fmt.Errorf("safetensors: invalid metadata: %w", err)
+			}
+			continue
+		}
+		var info tensorInfo
+		if err := json.Unmarshal(raw, &info); err != nil {
+			return nil, nil, fmt.Errorf("safetensors: invalid tensor %q: %w", name, err)
+		}
+		begin, end := info.DataOffsets[0], info.DataOffsets[1]
+		if begin < 0 || end < begin || end > int64(len(body)) {
+			return nil, nil, fmt.Errorf("safetensors: invalid data offsets of tensor %q", name)
+		}
+		size, ok := dtypeSizes[info.DType]
+		if !ok {
+			return nil, nil, fmt.Errorf("safetensors: unsupported dtype %q of tensor %q", info.DType, name)
+		}
+		numElements := int64(1)
+		for _, d := range info.Shape {
+			if d < 0 || (d > 0 && numElements > int64(len(body))/int64(d)) {
+				return nil, nil, fmt.Errorf("safetensors: invalid shape of tensor %q", name)
+			}
+			numElements *= int64(d)
+		}
+		if numElements*int64(size) != end-begin {
+			return nil, nil, fmt.Errorf("safetensors: shape %v of tensor %q does not match its data", info.Shape, name)
+		}
+		tensors[name] = tensor{
+			name:  name,
+			dtype: info.DType,
+			shape: info.Shape,
+			data:  body[begin:end],
+		}
+	}
+	return tensors, metadata, nil
+}
+
+// dtypeSizes maps the supported safetensors data types to their size
+// in bytes.
+var dtypeSizes = map[string]int{
+	"BOOL": 1, "U8": 1, "I8": 1,
+	"U16": 2, "I16": 2, "F16": 2, "BF16": 2,
+	"U32": 4, "I32": 4, "F32": 4,
+	"U64": 8, "I64": 8, "F64": 8,
+}
+
+// floatDType returns the safetensors data type of F.
+func floatDType[F gomaddness.Float]() string {
+	var f F
+	if unsafe.Sizeof(f) == 4 {
+		return "F32"
+	}
+	return "F64"
+}
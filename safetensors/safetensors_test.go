@@ -0,0 +1,201 @@
+// Copyright 2022, NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package safetensors
+
+import (
+	"bytes"
+	"math/rand"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/nlpodyssey/gomaddness"
+)
+
+func TestWrite(t *testing.T) {
+	t.Run("float32", testWrite[float32])
+	t.Run("float64", testWrite[float64])
+}
+
+func testWrite[F gomaddness.Float](t *testing.T) {
+	examples := randomExamples[F](64, 8)
+
+	for _, opts := range [][]gomaddness.Option{
+		nil,
+		{gomaddness.WithScaling(gomaddness.ScalingPerSubspace), gomaddness.WithRounding(gomaddness.RoundingStochastic)},
+		{gomaddness.WithPrecision(gomaddness.PrecisionFloat16), gomaddness.WithAggregation(gomaddness.AggregationAveraging)},
+		{gomaddness.WithPartitioning(gomaddness.PartitioningCorrelated)},
+		{gomaddness.WithEncoding(gomaddness.EncodingPQ), gomaddness.WithNumCodes(8)},
+		{gomaddness.WithBolt()},
+		{gomaddness.WithRotation(2)},
+		{gomaddness.WithEncoding(gomaddness.EncodingUnbalancedTree)},
+		{gomaddness.WithAssignment(gomaddness.AssignmentNearestPrototype)},
+		{gomaddness.WithMetric(gomaddness.MetricSquaredL2)},
+	} {
+		m := gomaddness.TrainMaddness(examples, examples[:3], 2, opts...)
+
+		var buf bytes.Buffer
+		if err := Write(&buf, m); err != nil {
+			t.Fatal(err)
+		}
+		m2, err := Read[F](&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(m, m2) {
+			t.Errorf("expected %+v, actual %+v", m, m2)
+		}
+	}
+
+	t.Run("uneven subspaces", func(t *testing.T) {
+		m := gomaddness.TrainMaddness(examples, examples[:3], 3)
+		var buf bytes.Buffer
+		if err := Write(&buf, m); err != nil {
+			t.Fatal(err)
+		}
+		m2, err := Read[F](&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(m, m2) {
+			t.Errorf("expected %+v, actual %+v", m, m2)
+		}
+	})
+
+	t.Run("file", func(t *testing.T) {
+		m := gomaddness.TrainMaddness(examples, examples[:3], 2)
+		path := filepath.Join(t.TempDir(), "model.safetensors")
+		if err := Save(path, m); err != nil {
+			t.Fatal(err)
+		}
+		m2, err := Load[F](path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(m, m2) {
+			t.Errorf("expected %+v, actual %+v", m, m2)
+		}
+	})
+}
+
+func TestRead_Validation(t *testing.T) {
+	m := gomaddness.TrainMaddness(randomExamples[float32](64, 8), randomExamples[float32](3, 8), 2)
+	tensors, err := modelTensors(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metadata := map[string]string{
+		"format":          formatName,
+		"num_subspaces":   "2",
+		"vector_size":     "8",
+		"sub_vector_size": "4",
+		"aggregation":     "exact",
+		"scaling":         "global",
+		"precision":       "uint8",
+		"rounding":        "nearest",
+		"random_seed":     "1",
+	}
+
+	testCases := []struct {
+		name   string
+		modify func(tensors []tensor, metadata map[string]string) []tensor
+	}{
+		{"wrong prototypes dtype", func(ts []tensor, _ map[string]string) []tensor {
+			ts[2].dtype = "I32"
+			return ts
+		}},
+		{"wrong prototypes shape", func(ts []tensor, _ map[string]string) []tensor {
+			ts[2].shape = []int{2, 8, 8}
+			return ts
+		}},
+		{"missing lookup tables", func(ts []tensor, _ map[string]string) []tensor {
+			return ts[:3]
+		}},
+		{"wrong lookup-table dtype", func(ts []tensor, md map[string]string) []tensor {
+			md["precision"] = "uint16"
+			return ts
+		}},
+		{"inconsistent vector size", func(ts []tensor, md map[string]string) []tensor {
+			md["vector_size"] = "9"
+			return ts
+		}},
+		{"unknown scaling", func(ts []tensor, md map[string]string) []tensor {
+			md["scaling"] = "foo"
+			return ts
+		}},
+		{"invalid split index", func(ts []tensor, _ map[string]string) []tensor {
+			for i, tn := range ts {
+				if tn.name == "split_indices" {
+					ts[i].data = append([]byte(nil), tn.data...)
+					ts[i].data[0] = 4
+				}
+			}
+			return ts
+		}},
+		{"unknown lookup-table metric", func(ts []tensor, _ map[string]string) []tensor {
+			return append(ts, tensor{"lut_metrics", "U8", []int{3}, []byte{0, 7, 0}})
+		}},
+		{"missing format", func(ts []tensor, md map[string]string) []tensor {
+			delete(md, "format")
+			return ts
+		}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ts := append([]tensor(nil), tensors...)
+			md := make(map[string]string, len(metadata))
+			for k, v := range metadata {
+				md[k] = v
+			}
+			ts = tc.modify(ts, md)
+
+			var buf bytes.Buffer
+			if err := writeTensors(&buf, ts, md); err != nil {
+				t.Fatal(err)
+			}
+			_, err := Read[float32](&buf)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			t.Log(err)
+		})
+	}
+
+	t.Run("float type mismatch", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := Write(&buf, m); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Read[float64](&buf); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := Write(&buf, m); err != nil {
+			t.Fatal(err)
+		}
+		data := buf.Bytes()
+		for _, n := range []int{0, 7, 8, 100, len(data) - 1} {
+			if _, err := Read[float32](bytes.NewReader(data[:n])); err == nil {
+				t.Errorf("expected error reading %d bytes", n)
+			}
+		}
+	})
+}
+
+func randomExamples[F gomaddness.Float](n, size int) gomaddness.Vectors[F] {
+	r := rand.New(rand.NewSource(int64(n)))
+	vs := make(gomaddness.Vectors[F], n)
+	for i := range vs {
+		vs[i] = make(gomaddness.Vector[F], size)
+		for j := range vs[i] {
+			vs[i][j] = F(r.NormFloat64())
+		}
+	}
+	return vs
+}
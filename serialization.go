@@ -0,0 +1,545 @@
+// Copyright 2022, NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gomaddness
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// The binary serialization format of a Maddness model is made of
+// little-endian values, in the following order:
+//
+//   - the magic string "GOMADDNS", the format version (uint32), and the
+//     size in bytes of the floating point values (uint32);
+//   - the model's parameters and settings, followed by the subspace
+//     offsets, if any (since version 2), by the permutation of the
+//     vector elements, if any (since version 3), and by the rows of the
+//     rotation matrix, if any, aligned to 64 bytes (since version 5);
+//   - the encoder of each subspace: the levels of the tree of a Hash, or
+//     the nodes of an UnbalancedTree, if any, followed by all the
+//     encoder's prototypes, as a single block of floats aligned to 64
+//     bytes;
+//   - the squared norms of the prototypes, if any, aligned to 64 bytes
+//     (since version 9);
+//   - the lookup tables, each one with its parameters (including its
+//     metric, since version 7, and the norm of its query vector, since
+//     version 8), followed by its data, aligned to 64 bytes.
+//
+// Since all floats and lookup-table data are suitably aligned, a model can
+// be memory-mapped and used without copying them (see OpenMapped).
+const (
+	formatMagic   = "GOMADDNS"
+	formatVersion = 9
+
+	// sectionAlignment is the alignment of prototypes and lookup-table
+	// data, from the beginning of the serialized model.
+	sectionAlignment = 64
+)
+
+// WriteTo writes the binary serialization of the model to w.
+// It implements io.WriterTo.
+func (m *Maddness[F]) WriteTo(w io.Writer) (int64, error) {
+	bw := &binaryWriter{w: w}
+
+	bw.bytes([]byte(formatMagic))
+	bw.uint32(formatVersion)
+	bw.uint32(uint32(floatSize[F]()))
+
+	bw.uint64(uint64(m.NumSubspaces))
+	bw.uint64(uint64(m.VectorSize))
+	bw.uint64(uint64(m.SubVectorSize))
+	bw.uint8(uint8(m.Aggregation))
+	bw.uint8(uint8(m.Scaling))
+	bw.uint8(uint8(m.Precision))
+	bw.uint8(uint8(m.Rounding))
+	bw.uint8(uint8(m.Partitioning))
+	bw.uint8(uint8(m.Encoding))
+	bw.uint8(uint8(m.Assignment))
+	bw.bytes([]byte{0}) // padding
+	bw.uint64(uint64(m.RandomSeed))
+	bw.uint64(uint64(len(m.SubspaceOffsets)))
+	for _, offset := range m.SubspaceOffsets {
+		bw.uint64(uint64(offset))
+	}
+	bw.uint64(uint64(len(m.Permutation)))
+	for _, j := range m.Permutation {
+		bw.uint64(uint64(j))
+	}
+	bw.uint64(uint64(len(m.Rotation)))
+	if m.Rotation != nil {
+		bw.align(sectionAlignment)
+		for _, row := range m.Rotation {
+			writeFloats(bw, row)
+		}
+	}
+
+	bw.uint64(uint64(len(m.Encoders)))
+	for _, e := range m.Encoders {
+		switch e := e.(type) {
+		case *Hash[F]:
+			writeHashingTree(bw, e)
+		case *UnbalancedTree[F]:
+			writeTreeNodes(bw, e.Nodes)
+		}
+		writePrototypes(bw, e.Prototypes())
+	}
+	bw.uint64(uint64(len(m.PrototypeSquaredNorms)))
+	if m.PrototypeSquaredNorms != nil {
+		bw.align(sectionAlignment)
+		writeFloats(bw, m.PrototypeSquaredNorms)
+	}
+
+	bw.uint64(uint64(len(m.LookupTables)))
+	for _, lut := range m.LookupTables {
+		writeLookupTable(bw, lut)
+	}
+
+	return bw.n, bw.err
+}
+
+func writeHashingTree[F Float](bw *binaryWriter, h *Hash[F]) {
+	bw.uint64(uint64(len(h.TreeLevels)))
+	for _, level := range h.TreeLevels {
+		bw.uint64(uint64(level.SplitIndex))
+		bw.uint64(uint64(len(level.SplitThresholds)))
+		writeFloats(bw, level.SplitThresholds)
+	}
+}
+
+func writeTreeNodes[F Float](bw *binaryWriter, nodes []TreeNode[F]) {
+	bw.uint64(uint64(len(nodes)))
+	thresholds := make([]F, len(nodes))
+	for i, node := range nodes {
+		bw.uint64(uint64(node.SplitIndex))
+		bw.uint64(uint64(int64(node.Children[0])))
+		bw.uint64(uint64(int64(node.Children[1])))
+		thresholds[i] = node.SplitThreshold
+	}
+	writeFloats(bw, thresholds)
+}
+
+func writePrototypes[F Float](bw *binaryWriter, protos Vectors[F]) {
+	protoSize := 0
+	if len(protos) > 0 {
+		protoSize = len(protos[0])
+	}
+	bw.uint64(uint64(len(protos)))
+	bw.uint64(uint64(protoSize))
+	bw.align(sectionAlignment)
+	for _, p := range protos {
+		writeFloats(bw, p)
+	}
+}
+
+func writeLookupTable[F Float](bw *binaryWriter, lut *LookupTable[F]) {
+	bw.uint8(uint8(lut.Precision))
+	hasOffsets := uint8(0)
+	if lut.Offsets != nil {
+		hasOffsets = 1
+	}
+	bw.uint8(hasOffsets)
+	bw.uint8(uint8(lut.Metric))
+	bw.align(8)
+	writeFloats(bw, []F{lut.Bias, lut.Scale, lut.MaxError, lut.QueryNorm})
+	if lut.Offsets != nil {
+		bw.uint64(uint64(len(lut.Offsets)))
+		writeFloats(bw, lut.Offsets)
+	}
+	bw.uint64(uint64(len(lut.Data)))
+	bw.align(sectionAlignment)
+	bw.bytes(lut.Data)
+}
+
+// ReadMaddness reads a model from its binary serialization, as written
+// by Maddness.WriteTo.
+func ReadMaddness[F Float](r io.Reader) (*Maddness[F], error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return decodeMaddness[F](data)
+}
+
+// Save writes the binary serialization of the model to a new file
+// at the given path, or truncates an existing one.
+func (m *Maddness[F]) Save(path string) (err error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if e := f.Close(); e != nil && err == nil {
+			err = e
+		}
+	}()
+
+	w := bufio.NewWriter(f)
+	if _, err = m.WriteTo(w); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// Load reads a model from the file at the given path, as written
+// by Maddness.Save.
+func Load[F Float](path string) (*Maddness[F], error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return decodeMaddness[F](data)
+}
+
+// decodeMaddness decodes a model from its binary serialization.
+//
+// The prototypes and the lookup-table data of the model share memory
+// with data, whenever possible.
+func decodeMaddness[F Float](data []byte) (*Maddness[F], error) {
+	br := &binaryReader{b: data}
+
+	if magic := br.bytes(len(formatMagic)); string(magic) != formatMagic {
+		return nil, errors.New("maddness: invalid model format")
+	}
+	version := br.uint32()
+	if version < 1 || version > formatVersion {
+		return nil, fmt.Errorf("maddness: unsupported model format version %d", version)
+	}
+	if size := br.uint32(); int(size) != floatSize[F]() {
+		return nil, fmt.Errorf("maddness: model floats have size %d, expected %d", size, floatSize[F]())
+	}
+
+	m := &Maddness[F]{
+		NumSubspaces:  br.int(),
+		VectorSize:    br.int(),
+		SubVectorSize: br.int(),
+		Aggregation:   Aggregation(br.uint8()),
+		Scaling:       Scaling(br.uint8()),
+		Precision:     Precision(br.uint8()),
+		Rounding:      Rounding(br.uint8()),
+		// Before version 3, the partitioning byte is zero padding,
+		// meaning PartitioningContiguous.
+		Partitioning: Partitioning(br.uint8()),
+		// Before version 4, the encoding byte is zero padding, meaning
+		// EncodingHashTree.
+		Encoding: Encoding(br.uint8()),
+		// Before version 6, the assignment byte is zero padding, meaning
+		// AssignmentEncoder.
+		Assignment: Assignment(br.uint8()),
+	}
+	br.bytes(1) // padding
+	m.RandomSeed = int64(br.uint64())
+	if version >= 2 {
+		if n := br.length(); n > 0 {
+			m.SubspaceOffsets = make([]int, n)
+			for i := range m.SubspaceOffsets {
+				m.SubspaceOffsets[i] = br.int()
+			}
+		}
+	}
+	if version >= 3 {
+		if n := br.length(); n > 0 {
+			m.Permutation = make([]int, n)
+			for i := range m.Permutation {
+				m.Permutation[i] = br.int()
+			}
+		}
+	}
+	if version >= 5 {
+		if n := br.length(); n > 0 {
+			br.align(sectionAlignment)
+			data := readFloats[F](br, n*m.VectorSize)
+			if br.err == nil {
+				m.Rotation = NewMatrixFromSlice(data, n, m.VectorSize, m.VectorSize).Vectors()
+			}
+		}
+	}
+
+	if newEncoder[F](m.Encoding) == nil {
+		return nil, fmt.Errorf("maddness: unsupported model encoding %d", m.Encoding)
+	}
+	m.Encoders = make([]Encoder[F], br.length())
+	for i := range m.Encoders {
+		m.Encoders[i] = readEncoder[F](br, m.Encoding)
+	}
+	if version >= 9 {
+		if n := br.length(); n > 0 {
+			br.align(sectionAlignment)
+			m.PrototypeSquaredNorms = readFloats[F](br, n)
+		}
+	}
+
+	m.LookupTables = make([]*LookupTable[F], br.length())
+	for i := range m.LookupTables {
+		m.LookupTables[i] = readLookupTable[F](br, version)
+	}
+
+	if br.err != nil {
+		return nil, br.err
+	}
+	if err := m.checkStructure(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// checkStructure reports an error if the sizes of the model's components
+// are not consistent with each other.
+func (m *Maddness[F]) checkStructure() error {
+	if err := m.checkSettings(); err != nil {
+		return err
+	}
+	if m.NumSubspaces <= 0 || m.NumSubspaces > m.VectorSize {
+		return errors.New("maddness: invalid model vector size or number of subspaces")
+	}
+	if err := m.checkSubspaceOffsets(); err != nil {
+		return err
+	}
+	if !isPermutation(m.Permutation, m.VectorSize) {
+		return errors.New("maddness: invalid model permutation")
+	}
+	if m.Rotation != nil && len(m.Rotation) != m.VectorSize {
+		return errors.New("maddness: invalid model rotation")
+	}
+	for _, row := range m.Rotation {
+		if len(row) != m.VectorSize {
+			return errors.New("maddness: invalid model rotation")
+		}
+	}
+	if len(m.Encoders) != m.NumSubspaces {
+		return errors.New("maddness: invalid number of model encoders")
+	}
+	for _, e := range m.Encoders {
+		if encoding, ok := encodingOf(e); !ok || encoding != m.Encoding {
+			return errors.New("maddness: invalid model encoder")
+		}
+	}
+	numProtos := m.Encoders[0].NumCodes()
+	if numProtos < 1 || numProtos > 256 {
+		return errors.New("maddness: invalid number of model prototypes")
+	}
+	if m.NumSubspaces*numProtos > MaxLookupTableSize {
+		return errors.New("maddness: invalid model lookup-table size")
+	}
+	if m.PrototypeSquaredNorms != nil && len(m.PrototypeSquaredNorms) != m.NumSubspaces*numProtos {
+		return errors.New("maddness: invalid number of model prototype norms")
+	}
+	for i, e := range m.Encoders {
+		begin, end := m.SubspaceBounds(i)
+		if e.NumCodes() != numProtos {
+			return errors.New("maddness: invalid number of model prototypes")
+		}
+		for _, p := range e.Prototypes() {
+			if len(p) != end-begin {
+				return errors.New("maddness: invalid size of model prototypes")
+			}
+		}
+		if _, ok := e.(*BoltEncoder[F]); ok && numProtos != BoltNumCodes {
+			return errors.New("maddness: invalid number of model prototypes")
+		}
+		if t, ok := e.(*UnbalancedTree[F]); ok && !isValidUnbalancedTree(t.Nodes, numProtos, end-begin) {
+			return errors.New("maddness: invalid model unbalanced tree")
+		}
+		h, ok := e.(*Hash[F])
+		if !ok {
+			continue
+		}
+		if numProtos != 1<<len(h.TreeLevels) {
+			return errors.New("maddness: invalid number of model prototypes")
+		}
+		for i, level := range h.TreeLevels {
+			if len(level.SplitThresholds) != 1<<i || level.SplitIndex < 0 || level.SplitIndex >= end-begin {
+				return errors.New("maddness: invalid model hashing tree")
+			}
+		}
+	}
+	for _, lut := range m.LookupTables {
+		if len(lut.Data) != m.NumSubspaces*numProtos*lut.Precision.Size() {
+			return errors.New("maddness: invalid size of model lookup-table data")
+		}
+		if lut.Offsets != nil && len(lut.Offsets) != m.NumSubspaces {
+			return errors.New("maddness: invalid number of model lookup-table offsets")
+		}
+		if lut.Precision.String() == unknownName {
+			return errors.New("maddness: invalid model lookup-table precision")
+		}
+		if lut.Metric.String() == unknownName {
+			return errors.New("maddness: invalid model lookup-table metric")
+		}
+	}
+	return nil
+}
+
+// checkSettings reports an error if any of the model's settings has an
+// unknown value.
+func (m *Maddness[F]) checkSettings() error {
+	if name := unknownSetting(
+		setting{"aggregation", m.Aggregation},
+		setting{"scaling", m.Scaling},
+		setting{"precision", m.Precision},
+		setting{"rounding", m.Rounding},
+		setting{"partitioning", m.Partitioning},
+		setting{"encoding", m.Encoding},
+		setting{"assignment", m.Assignment},
+	); name != "" {
+		return fmt.Errorf("maddness: invalid model %s", name)
+	}
+	return nil
+}
+
+// setting is a named enum value of a model or of the training options.
+type setting struct {
+	name  string
+	value fmt.Stringer
+}
+
+// unknownSetting returns the name of the first setting whose value is not
+// recognized, or an empty string if all values are known.
+func unknownSetting(settings ...setting) string {
+	for _, s := range settings {
+		if s.value.String() == unknownName {
+			return s.name
+		}
+	}
+	return ""
+}
+
+// checkSubspaceOffsets reports an error if the subspace offsets, if any,
+// do not partition the vectors into non-empty subspaces, the largest one
+// having size SubVectorSize.
+func (m *Maddness[F]) checkSubspaceOffsets() error {
+	if m.SubspaceOffsets == nil {
+		if m.SubVectorSize*m.NumSubspaces != m.VectorSize {
+			return errors.New("maddness: invalid model vector size or number of subspaces")
+		}
+		return nil
+	}
+	offsets := m.SubspaceOffsets
+	if len(offsets) != m.NumSubspaces+1 || offsets[0] != 0 || offsets[m.NumSubspaces] != m.VectorSize {
+		return errors.New("maddness: invalid model subspace offsets")
+	}
+	maxSize := 0
+	for i := 0; i < m.NumSubspaces; i++ {
+		size := offsets[i+1] - offsets[i]
+		if size <= 0 {
+			return errors.New("maddness: invalid model subspace offsets")
+		}
+		if size > maxSize {
+			maxSize = size
+		}
+	}
+	if maxSize != m.SubVectorSize {
+		return errors.New("maddness: invalid model sub-vector size")
+	}
+	return nil
+}
+
+// isPermutation reports whether p is nil, or a permutation of the integers
+// in [0, n).
+func isPermutation(p []int, n int) bool {
+	if p == nil {
+		return true
+	}
+	if len(p) != n {
+		return false
+	}
+	seen := make([]bool, n)
+	for _, j := range p {
+		if j < 0 || j >= n || seen[j] {
+			return false
+		}
+		seen[j] = true
+	}
+	return true
+}
+
+func readEncoder[F Float](br *binaryReader, encoding Encoding) Encoder[F] {
+	switch encoding {
+	case EncodingPQ:
+		return &PQEncoder[F]{Codebook: readPrototypes[F](br)}
+	case EncodingBolt:
+		return &BoltEncoder[F]{Codebook: readPrototypes[F](br)}
+	case EncodingUnbalancedTree:
+		t := &UnbalancedTree[F]{Nodes: readTreeNodes[F](br)}
+		t.Codebook = readPrototypes[F](br)
+		return t
+	}
+	h := &Hash[F]{
+		TreeLevels: make([]*HashingTreeLevel[F], br.length()),
+	}
+	for i := range h.TreeLevels {
+		h.TreeLevels[i] = &HashingTreeLevel[F]{
+			SplitIndex:      br.int(),
+			SplitThresholds: readFloats[F](br, br.length()),
+		}
+	}
+	h.Codebook = readPrototypes[F](br)
+	return h
+}
+
+func readTreeNodes[F Float](br *binaryReader) []TreeNode[F] {
+	n := br.length()
+	if br.err != nil {
+		return nil
+	}
+	if n > (len(br.b)-br.pos)/24 {
+		br.err = errUnexpectedEOF
+		return nil
+	}
+	nodes := make([]TreeNode[F], n)
+	for i := range nodes {
+		nodes[i].SplitIndex = br.int()
+		nodes[i].Children[0] = int(int64(br.uint64()))
+		nodes[i].Children[1] = int(int64(br.uint64()))
+	}
+	for i, t := range readFloats[F](br, n) {
+		nodes[i].SplitThreshold = t
+	}
+	return nodes
+}
+
+func readPrototypes[F Float](br *binaryReader) Vectors[F] {
+	numProtos := br.length()
+	protoSize := br.int()
+	br.align(sectionAlignment)
+	data := readFloats[F](br, numProtos*protoSize)
+	if br.err != nil {
+		return nil
+	}
+	return NewMatrixFromSlice(data, numProtos, protoSize, protoSize).Vectors()
+}
+
+func readLookupTable[F Float](br *binaryReader, version uint32) *LookupTable[F] {
+	lut := &LookupTable[F]{
+		Precision: Precision(br.uint8()),
+	}
+	hasOffsets := br.uint8() != 0
+	if version >= 7 {
+		lut.Metric = Metric(br.uint8())
+	}
+	br.align(8)
+	numParams := 3
+	if version >= 8 {
+		numParams = 4
+	}
+	params := readFloats[F](br, numParams)
+	if br.err != nil {
+		return lut
+	}
+	lut.Bias, lut.Scale, lut.MaxError = params[0], params[1], params[2]
+	if version >= 8 {
+		lut.QueryNorm = params[3]
+	}
+	if hasOffsets {
+		lut.Offsets = readFloats[F](br, br.length())
+	}
+	n := br.length()
+	br.align(sectionAlignment)
+	lut.Data = br.bytes(n)
+	return lut
+}
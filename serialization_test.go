@@ -0,0 +1,179 @@
+// Copyright 2022, NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gomaddness
+
+import (
+	"bytes"
+	"math/rand"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMaddness_WriteTo(t *testing.T) {
+	t.Run("float32", testMaddnessWriteTo[float32])
+	t.Run("float64", testMaddnessWriteTo[float64])
+}
+
+func testMaddnessWriteTo[F Float](t *testing.T) {
+	examples, queryVectors := randomExamples[F](128, 16, 3)
+
+	for _, opts := range [][]Option{
+		nil,
+		{WithScaling(ScalingPerSubspace), WithAggregation(AggregationAveraging)},
+		{WithPrecision(PrecisionFloat16), WithRandomSeed(42)},
+		{WithPartitioning(PartitioningCorrelated)},
+		{WithEncoding(EncodingPQ), WithNumCodes(16)},
+		{WithBolt()},
+		{WithEncoding(EncodingUnbalancedTree)},
+		{WithAssignment(AssignmentNearestPrototype)},
+		{WithMetric(MetricSquaredL2), WithPrecision(PrecisionUint16)},
+		{WithRotation(2), WithPartitioning(PartitioningVarianceBalanced)},
+	} {
+		m := TrainMaddness(examples, queryVectors, 4, opts...)
+
+		var buf bytes.Buffer
+		n, err := m.WriteTo(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != int64(buf.Len()) {
+			t.Errorf("expected %d bytes written, actual %d", buf.Len(), n)
+		}
+		data := buf.Bytes()
+
+		m2, err := ReadMaddness[F](bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(m, m2) {
+			t.Errorf("expected %+v, actual %+v", m, m2)
+		}
+
+		// Truncated data must be reported as an error, without panicking.
+		for i := 0; i < len(data); i++ {
+			if _, err := decodeMaddness[F](data[:i]); err == nil {
+				t.Fatalf("expected error decoding %d bytes of %d", i, len(data))
+			}
+		}
+	}
+
+	t.Run("uneven subspaces", func(t *testing.T) {
+		m := TrainMaddness(examples, queryVectors, 3)
+		var buf bytes.Buffer
+		if _, err := m.WriteTo(&buf); err != nil {
+			t.Fatal(err)
+		}
+		m2, err := ReadMaddness[F](&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(m, m2) {
+			t.Errorf("expected %+v, actual %+v", m, m2)
+		}
+
+		m2.SubspaceOffsets = []int{0, 5, 10, 15}
+		if err := m2.checkStructure(); err == nil {
+			t.Error("expected error with invalid subspace offsets")
+		}
+	})
+
+	t.Run("corrupt header", func(t *testing.T) {
+		m := TrainMaddness(examples, queryVectors, 4)
+		var buf bytes.Buffer
+		if _, err := m.WriteTo(&buf); err != nil {
+			t.Fatal(err)
+		}
+		// The aggregation, scaling, precision, rounding, partitioning,
+		// encoding and assignment bytes follow the magic string, the
+		// format version, the float size and three integers.
+		const settingsOffset = len(formatMagic) + 4 + 4 + 3*8
+		for i := 0; i < 7; i++ {
+			data := append([]byte(nil), buf.Bytes()...)
+			data[settingsOffset+i] = 0xff
+			if _, err := decodeMaddness[F](data); err == nil {
+				t.Errorf("expected error with setting %d corrupted", i)
+			}
+		}
+	})
+
+	t.Run("wrong float size", func(t *testing.T) {
+		m := TrainMaddness(examples, queryVectors, 4)
+		var buf bytes.Buffer
+		if _, err := m.WriteTo(&buf); err != nil {
+			t.Fatal(err)
+		}
+		var err error
+		if floatSize[F]() == 4 {
+			_, err = ReadMaddness[float64](&buf)
+		} else {
+			_, err = ReadMaddness[float32](&buf)
+		}
+		if err == nil {
+			t.Error("expected error")
+		}
+	})
+}
+
+func TestOpenMapped(t *testing.T) {
+	t.Run("float32", testOpenMapped[float32])
+	t.Run("float64", testOpenMapped[float64])
+}
+
+func testOpenMapped[F Float](t *testing.T) {
+	examples, queryVectors := randomExamples[F](128, 16, 3)
+	m := TrainMaddness(examples, queryVectors, 4, WithPrecision(PrecisionUint16))
+
+	path := filepath.Join(t.TempDir(), "model.bin")
+	if err := m.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := Load[F](path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m, loaded) {
+		t.Errorf("expected %+v, actual %+v", m, loaded)
+	}
+
+	mapped, err := OpenMapped[F](path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m, mapped.Maddness) {
+		t.Errorf("expected %+v, actual %+v", m, mapped.Maddness)
+	}
+	for _, ex := range examples {
+		q := mapped.Quantize(ex)
+		if !reflect.DeepEqual(q, m.Quantize(ex)) {
+			t.Fatalf("unexpected quantization %v", q)
+		}
+		lutIndices := mapped.LookupTableIndices(q)
+		for i := range queryVectors {
+			if a, b := mapped.DotProduct(lutIndices, i), m.DotProduct(lutIndices, i); a != b {
+				t.Fatalf("expected %v, actual %v", b, a)
+			}
+		}
+	}
+	if err := mapped.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := mapped.Close(); err != nil {
+		t.Errorf("unexpected error closing twice: %v", err)
+	}
+}
+
+func randomExamples[F Float](n, size, numQueries int) (examples, queryVectors Vectors[F]) {
+	r := rand.New(rand.NewSource(1))
+	examples = make(Vectors[F], n)
+	for i := range examples {
+		examples[i] = make(Vector[F], size)
+		for j := range examples[i] {
+			examples[i][j] = F(r.NormFloat64())
+		}
+	}
+	return examples, examples[:numQueries]
+}
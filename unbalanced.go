@@ -0,0 +1,167 @@
+// Copyright 2022, NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gomaddness
+
+// UnbalancedTree is an Encoder made of a binary regression tree whose
+// leaves can be at different depths: unlike the balanced tree of Hash,
+// the regions of the subspace with more variance are split more finely.
+type UnbalancedTree[F Float] struct {
+	// Nodes are the internal nodes of the tree, the first one being the
+	// root. A tree with a single leaf has no nodes.
+	Nodes []TreeNode[F] `json:"nodes"`
+	// Codebook holds the prototype vectors, one for each leaf of the tree.
+	Codebook Vectors[F] `json:"prototypes"`
+}
+
+// TreeNode is an internal node of an UnbalancedTree.
+type TreeNode[F Float] struct {
+	SplitIndex     int `json:"split_index"`
+	SplitThreshold F   `json:"split_threshold"`
+	// Children are the nodes reached by vectors whose value at SplitIndex
+	// is lower than SplitThreshold, and by the other vectors, respectively.
+	// A non-negative child is the index of a node, always greater than the
+	// index of its parent, while a negative child -(c+1) is the leaf with
+	// code c.
+	Children [2]int `json:"children"`
+}
+
+// numUnbalancedTreeLeaves is the number of leaves of the trees learned
+// for EncodingUnbalancedTree, the same as the balanced trees of Hash.
+const numUnbalancedTreeLeaves = 16
+
+// unbalancedTreeLeaf is a leaf of an UnbalancedTree during training.
+type unbalancedTreeLeaf[F Float] struct {
+	vectors Vectors[F]
+	loss    F
+	// parent is the index of the parent node, or -1 for the root, and side
+	// is the index of the leaf within the parent's children.
+	parent, side int
+}
+
+// TrainUnbalancedTree learns an UnbalancedTree with numLeaves leaves from
+// the given examples.
+//
+// Starting from a single leaf, it repeatedly splits the leaf with the
+// highest sum of squared errors from its mean, choosing the split that
+// most reduces it, among the elements with the highest variance.
+//
+// The number of leaves must be in the range [1, 256].
+func TrainUnbalancedTree[F Float](examples Vectors[F], numLeaves int) *UnbalancedTree[F] {
+	if numLeaves < 1 || numLeaves > 256 {
+		panic("maddness: invalid number of leaves (it must be in the range [1, 256])")
+	}
+	t := &UnbalancedTree[F]{}
+	leaves := []*unbalancedTreeLeaf[F]{newUnbalancedTreeLeaf(examples, -1, 0)}
+
+	for len(leaves) < numLeaves {
+		best := 0
+		for i, leaf := range leaves {
+			if leaf.loss > leaves[best].loss {
+				best = i
+			}
+		}
+		leaf := leaves[best]
+
+		node := TreeNode[F]{SplitIndex: -1}
+		var bestLoss F
+		for _, index := range (Buckets[F]{{Vectors: leaf.vectors}}).HeuristicSelectIndices() {
+			threshold, loss := leaf.vectors.OptimalSplitThreshold(index)
+			if node.SplitIndex < 0 || loss < bestLoss {
+				node.SplitIndex, node.SplitThreshold, bestLoss = index, threshold, loss
+			}
+		}
+		lt, gte := leaf.vectors.SplitByThreshold(node.SplitIndex, node.SplitThreshold)
+		// A leaf whose vectors are all equal cannot be split: both new
+		// leaves keep all of them.
+		if len(lt) == 0 {
+			lt = gte
+		}
+		if len(gte) == 0 {
+			gte = lt
+		}
+
+		nodeIndex := len(t.Nodes)
+		if leaf.parent >= 0 {
+			t.Nodes[leaf.parent].Children[leaf.side] = nodeIndex
+		}
+		t.Nodes = append(t.Nodes, node)
+		leaves[best] = newUnbalancedTreeLeaf(lt, nodeIndex, 0)
+		leaves = append(leaves, newUnbalancedTreeLeaf(gte, nodeIndex, 1))
+	}
+
+	t.Codebook = make(Vectors[F], len(leaves))
+	for code, leaf := range leaves {
+		t.Codebook[code] = leaf.vectors.Mean()
+		if leaf.parent >= 0 {
+			t.Nodes[leaf.parent].Children[leaf.side] = -(code + 1)
+		}
+	}
+	return t
+}
+
+func newUnbalancedTreeLeaf[F Float](vectors Vectors[F], parent, side int) *unbalancedTreeLeaf[F] {
+	return &unbalancedTreeLeaf[F]{
+		vectors: vectors,
+		loss:    vectors.CumulativeSSE()[len(vectors)-1],
+		parent:  parent,
+		side:    side,
+	}
+}
+
+// Encode returns the code of the leaf reached by v.
+func (t *UnbalancedTree[F]) Encode(v Vector[F]) uint8 {
+	if len(t.Nodes) == 0 {
+		return 0
+	}
+	i := 0
+	for {
+		node := &t.Nodes[i]
+		next := node.Children[1]
+		if v[node.SplitIndex] < node.SplitThreshold {
+			next = node.Children[0]
+		}
+		if next < 0 {
+			return uint8(-next - 1)
+		}
+		i = next
+	}
+}
+
+// Prototypes returns the prototype vectors of the leaves of the tree.
+func (t *UnbalancedTree[F]) Prototypes() Vectors[F] {
+	return t.Codebook
+}
+
+// NumCodes returns the number of leaves of the tree.
+func (t *UnbalancedTree[F]) NumCodes() int {
+	return len(t.Codebook)
+}
+
+// isValidUnbalancedTree reports whether the nodes form a tree with
+// numLeaves leaves, each one reached by exactly one path, whose split
+// indices are lower than size.
+func isValidUnbalancedTree[F Float](nodes []TreeNode[F], numLeaves, size int) bool {
+	if len(nodes) != numLeaves-1 {
+		return false
+	}
+	nodeSeen := make([]bool, len(nodes))
+	leafSeen := make([]bool, numLeaves)
+	for i, node := range nodes {
+		if node.SplitIndex < 0 || node.SplitIndex >= size {
+			return false
+		}
+		for _, c := range node.Children {
+			switch {
+			case c > i && c < len(nodes) && !nodeSeen[c]:
+				nodeSeen[c] = true
+			case c < 0 && -c-1 < numLeaves && !leafSeen[-c-1]:
+				leafSeen[-c-1] = true
+			default:
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,98 @@
+// Copyright 2022, NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gomaddness
+
+import (
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestTrainUnbalancedTree(t *testing.T) {
+	t.Run("float32", testTrainUnbalancedTree[float32])
+	t.Run("float64", testTrainUnbalancedTree[float64])
+}
+
+func testTrainUnbalancedTree[F Float](t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	examples := make(Vectors[F], 300)
+	for i := range examples {
+		// Most of the variance is in the examples with a positive first
+		// element, which should get deeper leaves.
+		if i%3 == 0 {
+			examples[i] = Vector[F]{F(-50 + 0.01*r.NormFloat64()), F(0.01 * r.NormFloat64())}
+		} else {
+			examples[i] = Vector[F]{F(5 + r.NormFloat64()), F(10 * r.NormFloat64())}
+		}
+	}
+
+	tree := TrainUnbalancedTree(examples, 16)
+	if tree.NumCodes() != 16 || len(tree.Nodes) != 15 {
+		t.Fatalf("expected 16 leaves and 15 nodes, actual %d and %d", tree.NumCodes(), len(tree.Nodes))
+	}
+	if !isValidUnbalancedTree(tree.Nodes, 16, 2) {
+		t.Fatalf("invalid tree %+v", tree.Nodes)
+	}
+	if c := tree.Nodes[0].Children[0]; c != -1 {
+		t.Errorf("expected the examples with a negative first element in a single leaf, actual child %d", c)
+	}
+
+	// The prototypes are the means of the examples reaching each leaf.
+	groups := make([]Vectors[F], tree.NumCodes())
+	for _, x := range examples {
+		code := tree.Encode(x)
+		groups[code] = append(groups[code], x)
+	}
+	for code, g := range groups {
+		if len(g) == 0 {
+			t.Errorf("no examples for leaf %d", code)
+			continue
+		}
+		if d := g.Mean().SquaredDistance(tree.Prototypes()[code]); d > 1e-6 {
+			t.Errorf("leaf %d: expected prototype %v, actual %v", code, g.Mean(), tree.Prototypes()[code])
+		}
+	}
+
+	t.Run("single leaf", func(t *testing.T) {
+		tree := TrainUnbalancedTree(examples, 1)
+		if len(tree.Nodes) != 0 || tree.NumCodes() != 1 || tree.Encode(examples[1]) != 0 {
+			t.Errorf("unexpected tree %+v", tree)
+		}
+	})
+}
+
+func TestTrainMaddness_unbalancedTree(t *testing.T) {
+	t.Run("float32", testTrainMaddnessUnbalancedTree[float32])
+	t.Run("float64", testTrainMaddnessUnbalancedTree[float64])
+}
+
+func testTrainMaddnessUnbalancedTree[F Float](t *testing.T) {
+	examples, queryVectors := randomExamples[F](256, 12, 2)
+
+	m := TrainMaddness(examples, queryVectors, 3, WithEncoding(EncodingUnbalancedTree))
+	if err := m.checkStructure(); err != nil {
+		t.Fatal(err)
+	}
+	var dump strings.Builder
+	if err := m.Dump(&dump); err != nil {
+		t.Fatal(err)
+	}
+	if out := dump.String(); strings.Count(out, "prototype ") != 3*16 || !strings.Contains(out, "encoding unbalanced-tree") {
+		t.Errorf("unexpected dump:\n%s", out)
+	}
+	for _, x := range examples[:16] {
+		q := m.Quantize(x)
+		r := m.Reconstruct(q)
+		lutIndices := m.LookupTableIndices(q)
+		for j, qv := range queryVectors {
+			expected := r.DotProduct(qv)
+			tolerance := float64(m.LookupTables[j].MaxError)*float64(m.NumSubspaces) + 1e-4
+			if actual := m.DotProduct(lutIndices, j); math.Abs(float64(actual-expected)) > tolerance {
+				t.Errorf("expected %v, actual %v", expected, actual)
+			}
+		}
+	}
+}
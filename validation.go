@@ -0,0 +1,150 @@
+// Copyright 2022, NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gomaddness
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+var (
+	// ErrVectorSize is reported for vectors whose size is not the
+	// expected one, such as rows of a ragged dataset.
+	ErrVectorSize = errors.New("invalid vector size")
+	// ErrNonFinite is reported for vectors containing NaN or infinite
+	// values.
+	ErrNonFinite = errors.New("non-finite value")
+)
+
+// Validate reports an error if the size of v differs from the given
+// size, or if v contains NaN or infinite values.
+func (v Vector[F]) Validate(size int) error {
+	if err := v.validate(size); err != nil {
+		return fmt.Errorf("maddness: %w", err)
+	}
+	return nil
+}
+
+// Validate reports an error if any vector does not satisfy Vector.Validate
+// with the given size. If size is negative, the vectors are expected to
+// have the size of the first one.
+//
+// The error identifies the first invalid vector by its index.
+func (vs Vectors[F]) Validate(size int) error {
+	if err := vs.validate(size); err != nil {
+		return fmt.Errorf("maddness: %w", err)
+	}
+	return nil
+}
+
+func (v Vector[F]) validate(size int) error {
+	if len(v) != size {
+		return fmt.Errorf("%w %d, expected %d", ErrVectorSize, len(v), size)
+	}
+	for i, x := range v {
+		if math.IsNaN(float64(x)) || math.IsInf(float64(x), 0) {
+			return fmt.Errorf("%w %v at index %d", ErrNonFinite, x, i)
+		}
+	}
+	return nil
+}
+
+func (vs Vectors[F]) validate(size int) error {
+	if size < 0 && len(vs) > 0 {
+		size = len(vs[0])
+	}
+	for i, v := range vs {
+		if err := v.validate(size); err != nil {
+			return fmt.Errorf("vector %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// ValidateTrainingData reports an error if the given arguments are not
+// suitable for TrainMaddness.
+//
+// All data examples and query vectors must be non-empty sets of vectors
+// of the same size, without NaN or infinite values, and numSubspaces must
+// be positive and not greater than the vector size. The options must be
+// valid, without unknown values of their settings, and the lookup tables
+// resulting from them must not have more than MaxLookupTableSize entries.
+func ValidateTrainingData[F Float](dataExamples, queryVectors Vectors[F], numSubspaces int, opts ...Option) error {
+	if len(dataExamples) == 0 {
+		return errors.New("maddness: invalid empty dataExamples")
+	}
+	if len(queryVectors) == 0 {
+		return errors.New("maddness: invalid empty queryVectors")
+	}
+	vecSize := len(dataExamples[0])
+	if vecSize == 0 {
+		return errors.New("maddness: invalid zero vector size")
+	}
+	if numSubspaces <= 0 || numSubspaces > vecSize {
+		return fmt.Errorf("maddness: invalid numSubspaces %d (it must be positive, and not greater than vectors' length %d)",
+			numSubspaces, vecSize)
+	}
+	if err := dataExamples.validate(vecSize); err != nil {
+		return fmt.Errorf("maddness: invalid dataExamples: %w", err)
+	}
+	if err := queryVectors.validate(vecSize); err != nil {
+		return fmt.Errorf("maddness: invalid queryVectors: %w", err)
+	}
+
+	o := newOptions(opts)
+	if name := unknownSetting(
+		setting{"aggregation", o.aggregation},
+		setting{"scaling", o.scaling},
+		setting{"precision", o.precision},
+		setting{"rounding", o.rounding},
+		setting{"partitioning", o.partitioning},
+		setting{"encoding", o.encoding},
+		setting{"assignment", o.assignment},
+		setting{"metric", o.metric},
+	); name != "" {
+		return fmt.Errorf("maddness: invalid %s", name)
+	}
+	for i, metric := range o.metrics {
+		if metric.String() == unknownName {
+			return fmt.Errorf("maddness: invalid metric of query vector %d", i)
+		}
+	}
+	if o.encoding == EncodingPQ && (o.numCodes < 1 || o.numCodes > 256) {
+		return errors.New("maddness: invalid number of codes (it must be in the range [1, 256])")
+	}
+	if o.metrics != nil && len(o.metrics) != len(queryVectors) {
+		return errors.New("maddness: the number of query metrics differs from the number of query vectors")
+	}
+	if size := numSubspaces * o.codesPerSubspace(); size > MaxLookupTableSize {
+		return fmt.Errorf("maddness: %d subspaces with %d codes each exceed the lookup-table size %d",
+			numSubspaces, o.codesPerSubspace(), MaxLookupTableSize)
+	}
+	return nil
+}
+
+// ValidateVector reports an error if v is not suitable for Quantize, that
+// is, if its size differs from m.VectorSize, or if it contains NaN or
+// infinite values.
+func (m *Maddness[F]) ValidateVector(v Vector[F]) error {
+	return v.Validate(m.VectorSize)
+}
+
+// ValidateVectors is like ValidateVector, for all the given vectors.
+func (m *Maddness[F]) ValidateVectors(vs Vectors[F]) error {
+	return vs.Validate(m.VectorSize)
+}
+
+// Validate reports an error if the model is not consistent: if any of its
+// settings has an unknown value, or if the sizes and contents of its
+// components (subspaces, permutation, rotation, encoders and lookup
+// tables) do not match each other.
+//
+// Models read with ReadMaddness, Load or OpenMapped are always validated.
+// Models decoded in other ways must be validated before use, since an
+// inconsistent model can make Quantize and DotProduct panic.
+func (m *Maddness[F]) Validate() error {
+	return m.checkStructure()
+}
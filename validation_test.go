@@ -0,0 +1,173 @@
+// Copyright 2022, NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gomaddness
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestVectors_Validate(t *testing.T) {
+	t.Run("float32", testVectorsValidate[float32])
+	t.Run("float64", testVectorsValidate[float64])
+}
+
+func testVectorsValidate[F Float](t *testing.T) {
+	testCases := []struct {
+		vs   Vectors[F]
+		size int
+		err  error
+	}{
+		{Vectors[F]{{1, 2}, {3, 4}}, 2, nil},
+		{Vectors[F]{{1, 2}, {3, 4}}, -1, nil},
+		{Vectors[F]{}, -1, nil},
+		{Vectors[F]{{1, 2}, {3, 4}}, 3, ErrVectorSize},
+		{Vectors[F]{{1, 2}, {3}}, -1, ErrVectorSize},
+		{Vectors[F]{{1, 2}, {3, F(math.NaN())}}, 2, ErrNonFinite},
+		{Vectors[F]{{F(math.Inf(-1)), 2}}, 2, ErrNonFinite},
+	}
+	for _, tc := range testCases {
+		err := tc.vs.Validate(tc.size)
+		if tc.err == nil && err != nil || !errors.Is(err, tc.err) {
+			t.Errorf("%v with size %d: expected %v, actual %v", tc.vs, tc.size, tc.err, err)
+		}
+	}
+}
+
+func TestValidateTrainingData(t *testing.T) {
+	t.Run("float32", testValidateTrainingData[float32])
+	t.Run("float64", testValidateTrainingData[float64])
+}
+
+func testValidateTrainingData[F Float](t *testing.T) {
+	examples, queryVectors := randomExamples[F](16, 4, 2)
+	if err := ValidateTrainingData(examples, queryVectors, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	ragged := examples.Copy()
+	ragged[5] = ragged[5][:3]
+	// Copy is shallow: the modified vector must be copied too.
+	nan := queryVectors.Copy()
+	nan[1] = nan[1].Copy()
+	nan[1][2] = F(math.NaN())
+
+	// Lookup-table indices are uint16: wide vectors can have too many
+	// subspaces for the number of codes.
+	wide, wideQueries := randomExamples[F](2, 4097, 1)
+	if err := ValidateTrainingData(wide, wideQueries, 256, WithEncoding(EncodingPQ)); err != nil {
+		t.Errorf("unexpected error with the largest lookup tables: %v", err)
+	}
+
+	testCases := []struct {
+		name                   string
+		examples, queryVectors Vectors[F]
+		numSubspaces           int
+		opts                   []Option
+	}{
+		{"empty examples", nil, queryVectors, 2, nil},
+		{"empty queries", examples, nil, 2, nil},
+		{"zero subspaces", examples, queryVectors, 0, nil},
+		{"too many subspaces", examples, queryVectors, 5, nil},
+		{"ragged examples", ragged, queryVectors, 2, nil},
+		{"non-finite queries", examples, nan, 2, nil},
+		{"wrong query size", examples, ragged[5:6], 2, nil},
+		{"invalid encoding", examples, queryVectors, 2, []Option{WithEncoding(42)}},
+		{"invalid aggregation", examples, queryVectors, 2, []Option{WithAggregation(42)}},
+		{"invalid scaling", examples, queryVectors, 2, []Option{WithScaling(42)}},
+		{"invalid precision", examples, queryVectors, 2, []Option{WithPrecision(9)}},
+		{"invalid rounding", examples, queryVectors, 2, []Option{WithRounding(42)}},
+		{"invalid partitioning", examples, queryVectors, 2, []Option{WithPartitioning(42)}},
+		{"invalid assignment", examples, queryVectors, 2, []Option{WithAssignment(42)}},
+		{"invalid metric", examples, queryVectors, 2, []Option{WithMetric(42)}},
+		{"invalid query metric", examples, queryVectors, 2, []Option{WithQueryMetrics(MetricDotProduct, 42)}},
+		{"invalid number of codes", examples, queryVectors, 2, []Option{WithEncoding(EncodingPQ), WithNumCodes(0)}},
+		{"wrong number of metrics", examples, queryVectors, 2, []Option{WithQueryMetrics(MetricSquaredL2)}},
+		{"too large pq lookup tables", wide, wideQueries, 257, []Option{WithEncoding(EncodingPQ)}},
+		{"too large lookup tables", wide, wideQueries, 4097, nil},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateTrainingData(tc.examples, tc.queryVectors, tc.numSubspaces, tc.opts...)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			defer func() {
+				if r, ok := recover().(error); !ok || r.Error() != err.Error() {
+					t.Errorf("expected panic with %v, actual %v", err, r)
+				}
+			}()
+			TrainMaddness(tc.examples, tc.queryVectors, tc.numSubspaces, tc.opts...)
+		})
+	}
+}
+
+func TestMaddness_ValidateVector(t *testing.T) {
+	t.Run("float32", testMaddnessValidateVector[float32])
+	t.Run("float64", testMaddnessValidateVector[float64])
+}
+
+func testMaddnessValidateVector[F Float](t *testing.T) {
+	examples, queryVectors := randomExamples[F](64, 4, 2)
+	m := TrainMaddness(examples, queryVectors, 2)
+
+	if err := m.ValidateVectors(examples); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.ValidateVector(Vector[F]{1, 2, 3}); !errors.Is(err, ErrVectorSize) {
+		t.Errorf("expected ErrVectorSize, actual %v", err)
+	}
+	if err := m.ValidateVector(Vector[F]{1, 2, F(math.Inf(1)), 4}); !errors.Is(err, ErrNonFinite) {
+		t.Errorf("expected ErrNonFinite, actual %v", err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic")
+		}
+	}()
+	m.Quantize(Vector[F]{1, 2, 3})
+}
+
+func TestMaddness_Validate(t *testing.T) {
+	t.Run("float32", testMaddnessValidate[float32])
+	t.Run("float64", testMaddnessValidate[float64])
+}
+
+func testMaddnessValidate[F Float](t *testing.T) {
+	examples, queryVectors := randomExamples[F](64, 8, 2)
+	m := TrainMaddness(examples, queryVectors, 4)
+	if err := m.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("too large lookup tables", func(t *testing.T) {
+		// 257 subspaces with 256 codes cannot be addressed by uint16
+		// lookup-table indices.
+		const numSubspaces = 257
+		codebook := make(Vectors[F], 256)
+		for i := range codebook {
+			codebook[i] = Vector[F]{F(i)}
+		}
+		m := &Maddness[F]{
+			NumSubspaces:  numSubspaces,
+			VectorSize:    numSubspaces,
+			SubVectorSize: 1,
+			Encoders:      make([]Encoder[F], numSubspaces),
+			Encoding:      EncodingPQ,
+		}
+		for i := range m.Encoders {
+			m.Encoders[i] = &PQEncoder[F]{Codebook: codebook}
+		}
+		if err := m.Validate(); err == nil {
+			t.Error("expected error")
+		}
+		m.NumSubspaces, m.VectorSize, m.Encoders = 256, 256, m.Encoders[:256]
+		if err := m.Validate(); err != nil {
+			t.Errorf("unexpected error with the largest lookup tables: %v", err)
+		}
+	})
+}
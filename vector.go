@@ -4,6 +4,8 @@
 
 package gomaddness
 
+import "math"
+
 // A Vector is a slice of floating point values.
 type Vector[F Float] []F
 
@@ -81,6 +83,20 @@ func (v Vector[_]) ArgMin() int {
 	return minIndex
 }
 
+// MinMax returns the minimum and the maximum values from the vector.
+func (v Vector[F]) MinMax() (min, max F) {
+	min, max = v[0], v[0]
+	for _, val := range v[1:] {
+		if val < min {
+			min = val
+		}
+		if val > max {
+			max = val
+		}
+	}
+	return
+}
+
 // DotProduct computes the dot product between v and other.
 func (v Vector[F]) DotProduct(other Vector[F]) (y F) {
 	_ = other[len(v)-1]
@@ -90,6 +106,22 @@ func (v Vector[F]) DotProduct(other Vector[F]) (y F) {
 	return
 }
 
+// Norm computes the Euclidean norm of v.
+func (v Vector[F]) Norm() F {
+	return F(math.Sqrt(float64(v.DotProduct(v))))
+}
+
+// SquaredDistance computes the squared Euclidean distance between v and
+// other.
+func (v Vector[F]) SquaredDistance(other Vector[F]) (y F) {
+	_ = other[len(v)-1]
+	for i, vi := range v {
+		d := vi - other[i]
+		y += d * d
+	}
+	return
+}
+
 // Copy returns a copy of the vector.
 func (v Vector[F]) Copy() Vector[F] {
 	c := make(Vector[F], len(v))
@@ -179,3 +179,43 @@ func testVectorDotProduct[F Float](t *testing.T) {
 		t.Fatalf("expected %v, actual %v", expected, actual)
 	}
 }
+
+func TestVector_MinMax(t *testing.T) {
+	t.Run("float32", testVectorMinMax[float32])
+	t.Run("float64", testVectorMinMax[float64])
+}
+
+func testVectorMinMax[F Float](t *testing.T) {
+	v := Vector[F]{3, -1, 7, 2}
+
+	min, max := v.MinMax()
+	if min != -1 || max != 7 {
+		t.Fatalf("expected (-1, 7), actual (%v, %v)", min, max)
+	}
+}
+
+func TestVector_Norm(t *testing.T) {
+	t.Run("float32", testVectorNorm[float32])
+	t.Run("float64", testVectorNorm[float64])
+}
+
+func testVectorNorm[F Float](t *testing.T) {
+	v := Vector[F]{3, -4}
+
+	if n := v.Norm(); n != 5 {
+		t.Fatalf("expected 5, actual %v", n)
+	}
+}
+
+func TestVector_SquaredDistance(t *testing.T) {
+	t.Run("float32", testVectorSquaredDistance[float32])
+	t.Run("float64", testVectorSquaredDistance[float64])
+}
+
+func testVectorSquaredDistance[F Float](t *testing.T) {
+	v := Vector[F]{1, 2, 3}
+
+	if d := v.SquaredDistance(Vector[F]{4, 2, -1}); d != 25 {
+		t.Fatalf("expected 25, actual %v", d)
+	}
+}
@@ -140,3 +140,18 @@ func (vs Vectors[F]) Mean() Vector[F] {
 	}
 	return sum.DivScalar(F(len(vs)))
 }
+
+// Matrix copies the vectors into a new contiguous Matrix.
+func (vs Vectors[F]) Matrix() Matrix[F] {
+	if len(vs) == 0 {
+		return NewMatrix[F](0, 0)
+	}
+	m := NewMatrix[F](len(vs), len(vs[0]))
+	for i, v := range vs {
+		if len(v) != m.Cols {
+			panic("maddness: vectors of different length")
+		}
+		copy(m.Row(i), v)
+	}
+	return m
+}